@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WeatherAlert is an active weather alert for a location. Severity and
+// urgency use the CAP vocabulary, e.g. Severe and Immediate, and are Unknown
+// when the provider doesn't grade its alerts.
+type WeatherAlert struct {
+	ID          string     `json:"id,omitempty"`
+	Event       string     `json:"event"`
+	Headline    string     `json:"headline,omitempty"`
+	Description string     `json:"description"`
+	Severity    string     `json:"severity"`
+	Urgency     string     `json:"urgency"`
+	Certainty   string     `json:"certainty,omitempty"`
+	Onset       *time.Time `json:"onset"`
+	Expires     *time.Time `json:"expires"`
+	Sender      string     `json:"sender,omitempty"`
+}
+
+// AlertEvent is an alert as sent to streaming outputs, separately from the
+// weather record of its location
+type AlertEvent struct {
+	LocationID   string    `json:"location_id"`
+	LocationName string    `json:"location_name"`
+	Timestamp    time.Time `json:"timestamp"`
+	Source       string    `json:"source"`
+	WeatherAlert
+}
+
+// alertEvents returns one event for each alert in a weather record
+func alertEvents(data WeatherData) []AlertEvent {
+	events := make([]AlertEvent, len(data.Alerts))
+	for i, alert := range data.Alerts {
+		events[i] = AlertEvent{
+			LocationID:   data.LocationID,
+			LocationName: data.LocationName,
+			Timestamp:    data.Timestamp,
+			Source:       data.Source,
+			WeatherAlert: alert,
+		}
+	}
+	return events
+}
+
+// alertSeverityRank orders CAP severities from most to least severe
+var alertSeverityRank = map[string]int{
+	"Extreme":  0,
+	"Severe":   1,
+	"Moderate": 2,
+	"Minor":    3,
+}
+
+// sortAlerts orders alerts from most to least severe, keeping the provider's
+// order otherwise
+func sortAlerts(alerts []WeatherAlert) {
+	rank := func(severity string) int {
+		if r, ok := alertSeverityRank[severity]; ok {
+			return r
+		}
+		return len(alertSeverityRank)
+	}
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return rank(alerts[i].Severity) < rank(alerts[j].Severity)
+	})
+}
+
+// NWSAlertsResponse is the subset of the NWS active alerts response we use
+type NWSAlertsResponse struct {
+	Features []struct {
+		Properties struct {
+			ID          string `json:"id"`
+			Event       string `json:"event"`
+			Headline    string `json:"headline"`
+			Description string `json:"description"`
+			Severity    string `json:"severity"`
+			Urgency     string `json:"urgency"`
+			Certainty   string `json:"certainty"`
+			Onset       string `json:"onset"`
+			Expires     string `json:"expires"`
+			SenderName  string `json:"senderName"`
+		} `json:"properties"`
+	} `json:"features"`
+}
+
+// getNWSAlerts fetches the alerts in effect at a point
+func getNWSAlerts(ctx context.Context, client *http.Client, lat, lon float64) ([]WeatherAlert, error) {
+	alertsURL := fmt.Sprintf("%s%s?point=%.4f,%.4f", endpoints.NWS, nwsAlertsEndpoint, lat, lon)
+	if err := validateURL(alertsURL); err != nil {
+		return nil, fmt.Errorf("URL validation failed: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", alertsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating alerts request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching NWS alerts: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("NWS alerts API error: status code %d", resp.StatusCode)
+	}
+
+	var alertsData NWSAlertsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&alertsData); err != nil {
+		return nil, fmt.Errorf("error decoding NWS alerts response: %w", err)
+	}
+
+	alerts := make([]WeatherAlert, 0, len(alertsData.Features))
+	for _, feature := range alertsData.Features {
+		props := feature.Properties
+		alerts = append(alerts, WeatherAlert{
+			ID:          props.ID,
+			Event:       props.Event,
+			Headline:    props.Headline,
+			Description: props.Description,
+			Severity:    props.Severity,
+			Urgency:     props.Urgency,
+			Certainty:   props.Certainty,
+			Onset:       parseAlertTime(props.Onset),
+			Expires:     parseAlertTime(props.Expires),
+			Sender:      props.SenderName,
+		})
+	}
+	return alerts, nil
+}
+
+// parseAlertTime parses an optional RFC 3339 alert time
+func parseAlertTime(value string) *time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// owmAlert is an alert in the OpenWeatherMap One Call response
+type owmAlert struct {
+	SenderName  string `json:"sender_name"`
+	Event       string `json:"event"`
+	Start       int64  `json:"start"`
+	End         int64  `json:"end"`
+	Description string `json:"description"`
+}
+
+// convertOWMAlerts maps OpenWeatherMap alerts onto WeatherAlert.
+// OpenWeatherMap passes on national agencies' alerts without grading them.
+func convertOWMAlerts(owmAlerts []owmAlert) []WeatherAlert {
+	alerts := make([]WeatherAlert, 0, len(owmAlerts))
+	for _, alert := range owmAlerts {
+		converted := WeatherAlert{
+			Event:       alert.Event,
+			Description: alert.Description,
+			Severity:    "Unknown",
+			Urgency:     "Unknown",
+			Sender:      alert.SenderName,
+		}
+		if alert.Start != 0 {
+			converted.Onset = ptr(time.Unix(alert.Start, 0))
+		}
+		if alert.End != 0 {
+			converted.Expires = ptr(time.Unix(alert.End, 0))
+		}
+		alerts = append(alerts, converted)
+	}
+	return alerts
+}
+
+// describeAlert returns a one-line description of an alert for text output
+func describeAlert(alert WeatherAlert) string {
+	result := alert.Event
+
+	var grades []string
+	for _, grade := range []string{alert.Severity, alert.Urgency} {
+		if grade != "" && grade != "Unknown" {
+			grades = append(grades, grade)
+		}
+	}
+	if len(grades) > 0 {
+		result += " (" + strings.Join(grades, ", ") + ")"
+	}
+	if alert.Onset != nil {
+		result += " from " + alert.Onset.Local().Format("Mon Jan 2 15:04 MST")
+	}
+	if alert.Expires != nil {
+		result += " until " + alert.Expires.Local().Format("Mon Jan 2 15:04 MST")
+	}
+	return result
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConvertOWMAlerts(t *testing.T) {
+	var data struct {
+		Alerts []owmAlert `json:"alerts"`
+	}
+	raw := `{"alerts": [{
+		"sender_name": "NWS Boulder (Northeast Colorado)",
+		"event": "Red Flag Warning",
+		"start": 1717243200,
+		"end": 1717272000,
+		"description": "Gusty winds and low humidity.",
+		"tags": ["Fire warning"]
+	}]}`
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		t.Fatalf("Expected alerts to decode, got: %v", err)
+	}
+
+	alerts := convertOWMAlerts(data.Alerts)
+	if len(alerts) != 1 {
+		t.Fatalf("Expected 1 alert, got %d", len(alerts))
+	}
+	alert := alerts[0]
+	if alert.Event != "Red Flag Warning" || alert.Sender != "NWS Boulder (Northeast Colorado)" {
+		t.Errorf("Unexpected alert: %+v", alert)
+	}
+
+	// OpenWeatherMap doesn't grade alerts
+	if alert.Severity != "Unknown" || alert.Urgency != "Unknown" {
+		t.Errorf("Expected unknown severity and urgency, got %s and %s", alert.Severity, alert.Urgency)
+	}
+	if alert.Onset == nil || alert.Onset.Unix() != 1717243200 || alert.Expires == nil || alert.Expires.Unix() != 1717272000 {
+		t.Errorf("Expected onset and expiry from start and end, got %v and %v", alert.Onset, alert.Expires)
+	}
+	if description := describeAlert(alert); !strings.HasPrefix(description, "Red Flag Warning from") {
+		t.Errorf("Expected ungraded alerts to be described without grades, got %q", description)
+	}
+}
+
+func TestSortAlerts(t *testing.T) {
+	alerts := []WeatherAlert{
+		{Event: "Wind Advisory", Severity: "Moderate"},
+		{Event: "Special Weather Statement", Severity: "Unknown"},
+		{Event: "Tornado Warning", Severity: "Extreme"},
+		{Event: "Heat Advisory", Severity: "Moderate"},
+	}
+	sortAlerts(alerts)
+
+	expected := []string{"Tornado Warning", "Wind Advisory", "Heat Advisory", "Special Weather Statement"}
+	for i, alert := range alerts {
+		if alert.Event != expected[i] {
+			t.Errorf("Expected alert %d to be %s, got %s", i, expected[i], alert.Event)
+		}
+	}
+}
+
+func TestAlertEvents(t *testing.T) {
+	data := WeatherData{
+		LocationID:   "zip:80202",
+		LocationName: "Denver",
+		Timestamp:    time.Date(2024, 6, 1, 18, 0, 0, 0, time.UTC),
+		Source:       "nws",
+		Alerts:       []WeatherAlert{{Event: "Heat Advisory"}, {Event: "Air Quality Alert"}},
+	}
+
+	events := alertEvents(data)
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 events, got %d", len(events))
+	}
+
+	// Each event stands on its own, with the location it applies to
+	raw, err := json.Marshal(events[1])
+	if err != nil {
+		t.Fatalf("Expected event to encode, got: %v", err)
+	}
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("Expected event to decode, got: %v", err)
+	}
+	if decoded["location_id"] != "zip:80202" || decoded["event"] != "Air Quality Alert" || decoded["source"] != "nws" {
+		t.Errorf("Unexpected event: %s", raw)
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// Name of the cache file inside the cache directory
+	cacheFileName = "geocode-cache.json"
+
+	// Default lifetime of cached geocoding results
+	defaultCacheTTL = 30 * 24 * time.Hour
+)
+
+// cacheEntry is a cached value with the time it was stored
+type cacheEntry struct {
+	Value    json.RawMessage `json:"value"`
+	StoredAt time.Time       `json:"stored_at"`
+}
+
+// Cache is a small persistent key-value cache for lookups whose results
+// rarely change, such as ZIP code coordinates and NWS point metadata. A nil
+// *Cache is valid and caches nothing.
+type Cache struct {
+	mu      sync.Mutex
+	path    string
+	ttl     time.Duration
+	entries map[string]cacheEntry
+}
+
+// openCaches holds one Cache per file so that every geocoder and provider in
+// the process shares the same entries
+var openCaches = struct {
+	sync.Mutex
+	caches map[string]*Cache
+}{caches: map[string]*Cache{}}
+
+// OpenCache returns the cache stored in dir, loading it from disk on first use
+func OpenCache(dir string, ttl time.Duration) (*Cache, error) {
+	path := filepath.Join(dir, cacheFileName)
+
+	openCaches.Lock()
+	defer openCaches.Unlock()
+
+	if cache, ok := openCaches.caches[path]; ok {
+		return cache, nil
+	}
+
+	if ttl <= 0 {
+		ttl = defaultCacheTTL
+	}
+	cache := &Cache{path: path, ttl: ttl, entries: map[string]cacheEntry{}}
+
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		// Start with an empty cache
+	case err != nil:
+		return nil, fmt.Errorf("error reading cache: %w", err)
+	default:
+		if err := json.Unmarshal(data, &cache.entries); err != nil {
+			return nil, fmt.Errorf("error decoding cache %s: %w", path, err)
+		}
+	}
+
+	openCaches.caches[path] = cache
+	return cache, nil
+}
+
+// configCache opens the cache configured by -cache-dir, or returns nil when
+// caching is disabled
+func configCache(config *Config) (*Cache, error) {
+	if config.CacheDir == "" {
+		return nil, nil
+	}
+	return OpenCache(config.CacheDir, config.CacheTTL)
+}
+
+// RunCacheCommand runs a "cache" subcommand. The only subcommand is "clear",
+// which removes the cache in -cache-dir.
+func RunCacheCommand(config *Config, args []string) error {
+	if len(args) != 1 || args[0] != "clear" {
+		return fmt.Errorf("usage: weathercli -cache-dir=DIR cache clear")
+	}
+	if config.CacheDir == "" {
+		return fmt.Errorf("-cache-dir is required")
+	}
+
+	cache, err := OpenCache(config.CacheDir, config.CacheTTL)
+	if err != nil {
+		// A corrupt cache can still be removed
+		cache = &Cache{path: filepath.Join(config.CacheDir, cacheFileName)}
+	}
+
+	count := len(cache.entries)
+	if err := cache.Clear(); err != nil {
+		return err
+	}
+	log.Printf("Cleared %d cached entries from %s", count, cache.path)
+	return nil
+}
+
+// Get decodes the cached value for key into value. It reports false if the key
+// is missing or has expired.
+func (c *Cache) Get(key string, value any) bool {
+	if c == nil {
+		return false
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+
+	if !ok || time.Since(entry.StoredAt) > c.ttl {
+		return false
+	}
+	return json.Unmarshal(entry.Value, value) == nil
+}
+
+// Set stores a value and writes the cache to disk
+func (c *Cache) Set(key string, value any) error {
+	if c == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("error encoding cache entry: %w", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = cacheEntry{Value: data, StoredAt: time.Now()}
+	return c.save()
+}
+
+// Clear removes every entry and deletes the cache file
+func (c *Cache) Clear() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries = map[string]cacheEntry{}
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("error removing cache: %w", err)
+	}
+	return nil
+}
+
+// Len returns the number of entries in the cache, including expired ones
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.entries)
+}
+
+// save writes the cache atomically so a crash never leaves a partial file.
+// The caller must hold c.mu.
+func (c *Cache) save() error {
+	// Drop expired entries while we're rewriting the file anyway
+	for key, entry := range c.entries {
+		if time.Since(entry.StoredAt) > c.ttl {
+			delete(c.entries, key)
+		}
+	}
+
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return fmt.Errorf("error encoding cache: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o755); err != nil {
+		return fmt.Errorf("error creating cache directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), cacheFileName+".*")
+	if err != nil {
+		return fmt.Errorf("error writing cache: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("error writing cache: %w", err)
+	}
+	return nil
+}
+
+// cachedGeocoder wraps a Geocoder with the persistent cache
+type cachedGeocoder struct {
+	geocoder Geocoder
+	cache    *Cache
+	source   string
+}
+
+// geocodeResult is the cached form of a geocoding result
+type geocodeResult struct {
+	Lat  float64 `json:"lat"`
+	Lon  float64 `json:"lon"`
+	Name string  `json:"name"`
+}
+
+func (g *cachedGeocoder) Geocode(ctx context.Context, loc Location) (float64, float64, string, error) {
+	// Coordinates need no lookup
+	if loc.Kind == LocationCoords {
+		return g.geocoder.Geocode(ctx, loc)
+	}
+
+	// Results differ between OpenWeatherMap and the keyless sources
+	key := fmt.Sprintf("geo:%s:%s", g.source, loc.ID())
+
+	var result geocodeResult
+	if g.cache.Get(key, &result) {
+		return result.Lat, result.Lon, result.Name, nil
+	}
+
+	lat, lon, name, err := g.geocoder.Geocode(ctx, loc)
+	if err != nil {
+		return 0, 0, "", err
+	}
+
+	// A failure to persist the cache shouldn't fail the lookup itself
+	if err := g.cache.Set(key, geocodeResult{Lat: lat, Lon: lon, Name: name}); err != nil {
+		log.Printf("Error updating cache: %v", err)
+	}
+	return lat, lon, name, nil
+}
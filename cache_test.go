@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// countingGeocoder is a Geocoder that counts lookups
+type countingGeocoder struct {
+	calls int
+}
+
+func (g *countingGeocoder) Geocode(ctx context.Context, loc Location) (float64, float64, string, error) {
+	g.calls++
+	if loc.ZIP == "00000" {
+		return 0, 0, "", fmt.Errorf("unknown ZIP code: %s", loc.ZIP)
+	}
+	return 34.09, -118.41, "Beverly Hills", nil
+}
+
+func TestCachedGeocoder(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := OpenCache(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error opening cache, got: %v", err)
+	}
+
+	inner := &countingGeocoder{}
+	geocoder := &cachedGeocoder{geocoder: inner, cache: cache, source: "test"}
+	loc := Location{Kind: LocationZip, ZIP: "90210"}
+
+	for i := 0; i < 3; i++ {
+		lat, _, name, err := geocoder.Geocode(context.Background(), loc)
+		if err != nil || lat != 34.09 || name != "Beverly Hills" {
+			t.Fatalf("Unexpected geocode result: %v, %s (%v)", lat, name, err)
+		}
+	}
+	if inner.calls != 1 {
+		t.Errorf("Expected 1 lookup with caching, got %d", inner.calls)
+	}
+
+	// Errors are not cached
+	geocoder.Geocode(context.Background(), Location{Kind: LocationZip, ZIP: "00000"}) //nolint
+	geocoder.Geocode(context.Background(), Location{Kind: LocationZip, ZIP: "00000"}) //nolint
+	if inner.calls != 3 {
+		t.Errorf("Expected failed lookups to be retried, got %d calls", inner.calls)
+	}
+
+	// Entries persist across processes
+	delete(openCaches.caches, cache.path)
+	reloaded, err := OpenCache(dir, time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error reopening cache, got: %v", err)
+	}
+	var result geocodeResult
+	if !reloaded.Get("geo:test:90210", &result) || result.Name != "Beverly Hills" {
+		t.Errorf("Expected cached entry after reload, got %+v", result)
+	}
+
+	// Clearing removes everything
+	if err := RunCacheCommand(&Config{CacheDir: dir}, []string{"clear"}); err != nil {
+		t.Fatalf("Expected no error clearing cache, got: %v", err)
+	}
+	if reloaded.Len() != 0 {
+		t.Errorf("Expected empty cache after clear, got %d entries", reloaded.Len())
+	}
+}
+
+func TestCacheExpiry(t *testing.T) {
+	cache, err := OpenCache(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatalf("Expected no error opening cache, got: %v", err)
+	}
+
+	cache.entries["old"] = cacheEntry{Value: []byte(`"value"`), StoredAt: time.Now().Add(-2 * time.Hour)}
+
+	var value string
+	if cache.Get("old", &value) {
+		t.Error("Expected expired entry to be ignored")
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Default number of consecutive failures before a provider is skipped
+	defaultBreakerThreshold = 3
+
+	// Default time a provider is skipped once its breaker has tripped
+	defaultBreakerCooldown = 5 * time.Minute
+)
+
+// providerHealth tracks consecutive failures for a single provider
+type providerHealth struct {
+	failures  int
+	openUntil time.Time
+}
+
+// healthRegistry holds provider health across runs so that interval mode
+// remembers which providers have been failing
+var healthRegistry = struct {
+	sync.Mutex
+	providers map[string]*providerHealth
+}{providers: map[string]*providerHealth{}}
+
+// providerAvailable reports whether a provider's circuit breaker is closed
+func providerAvailable(name string, now time.Time) (bool, time.Time) {
+	healthRegistry.Lock()
+	defer healthRegistry.Unlock()
+
+	health, ok := healthRegistry.providers[name]
+	if !ok || now.After(health.openUntil) {
+		return true, time.Time{}
+	}
+	return false, health.openUntil
+}
+
+// recordProviderSuccess resets the failure count for a provider
+func recordProviderSuccess(name string) {
+	healthRegistry.Lock()
+	defer healthRegistry.Unlock()
+
+	delete(healthRegistry.providers, name)
+}
+
+// recordProviderFailure counts a failure and trips the breaker once the
+// threshold is reached. It reports whether the breaker was tripped.
+func recordProviderFailure(name string, threshold int, cooldown time.Duration, now time.Time) bool {
+	healthRegistry.Lock()
+	defer healthRegistry.Unlock()
+
+	health, ok := healthRegistry.providers[name]
+	if !ok {
+		health = &providerHealth{}
+		healthRegistry.providers[name] = health
+	}
+
+	health.failures++
+	if health.failures >= threshold {
+		health.failures = 0
+		health.openUntil = now.Add(cooldown)
+		return true
+	}
+	return false
+}
+
+// resetProviderHealth clears all recorded provider health
+func resetProviderHealth() {
+	healthRegistry.Lock()
+	defer healthRegistry.Unlock()
+
+	healthRegistry.providers = map[string]*providerHealth{}
+}
+
+// providerChain tries providers in order until one succeeds
+type providerChain struct {
+	providers []WeatherProvider
+	threshold int
+	cooldown  time.Duration
+	verbose   bool
+
+	// Providers left out of the chain because they aren't configured
+	skipped []string
+}
+
+func (c *providerChain) Name() string {
+	names := make([]string, len(c.providers))
+	for i, provider := range c.providers {
+		names[i] = provider.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+func (c *providerChain) GetWeather(ctx context.Context, lat, lon float64) (WeatherResponse, error) {
+	threshold := c.threshold
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+	cooldown := c.cooldown
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+
+	var errs []error
+	for _, provider := range c.providers {
+		name := provider.Name()
+
+		if ok, until := providerAvailable(name, time.Now()); !ok {
+			if c.verbose {
+				log.Printf("Skipping provider %s: circuit open until %s", name, until.Format(time.RFC3339))
+			}
+			errs = append(errs, fmt.Errorf("%s: circuit open until %s", name, until.Format(time.RFC3339)))
+			continue
+		}
+
+		weather, err := provider.GetWeather(ctx, lat, lon)
+		if err != nil {
+			// A cancelled request says nothing about the provider's health,
+			// and there's no time left to try the others
+			if ctx.Err() != nil {
+				return WeatherResponse{}, fmt.Errorf("%s: %w", name, ctx.Err())
+			}
+			if recordProviderFailure(name, threshold, cooldown, time.Now()) {
+				log.Printf("Provider %s failed %d times in a row; skipping it for %v", name, threshold, cooldown)
+			}
+			if len(c.providers) > 1 {
+				log.Printf("Provider %s failed: %v", name, err)
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+
+		recordProviderSuccess(name)
+		if weather.Provider == "" {
+			weather.Provider = name
+		}
+		return weather, nil
+	}
+
+	if len(errs) == 1 {
+		return WeatherResponse{}, errs[0]
+	}
+	return WeatherResponse{}, fmt.Errorf("all providers failed: %w", errors.Join(errs...))
+}
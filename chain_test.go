@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fakeProvider is a WeatherProvider that returns a fixed result
+type fakeProvider struct {
+	name  string
+	err   error
+	calls int
+}
+
+func (p *fakeProvider) Name() string {
+	return p.name
+}
+
+func (p *fakeProvider) GetWeather(ctx context.Context, lat, lon float64) (WeatherResponse, error) {
+	p.calls++
+	if p.err != nil {
+		return WeatherResponse{}, p.err
+	}
+	return WeatherResponse{}, nil
+}
+
+func TestProviderChainFallback(t *testing.T) {
+	resetProviderHealth()
+	defer resetProviderHealth()
+
+	failing := &fakeProvider{name: "failing", err: fmt.Errorf("status code 500")}
+	working := &fakeProvider{name: "working"}
+	chain := &providerChain{providers: []WeatherProvider{failing, working}}
+
+	weather, err := chain.GetWeather(context.Background(), 0, 0)
+	if err != nil {
+		t.Fatalf("Expected fallback to succeed, got: %v", err)
+	}
+	if weather.Provider != "working" {
+		t.Errorf("Expected response from working provider, got %q", weather.Provider)
+	}
+	if chain.Name() != "failing,working" {
+		t.Errorf("Expected chain name failing,working, got %s", chain.Name())
+	}
+}
+
+func TestProviderChainCircuitBreaker(t *testing.T) {
+	resetProviderHealth()
+	defer resetProviderHealth()
+
+	failing := &fakeProvider{name: "failing", err: fmt.Errorf("status code 500")}
+	working := &fakeProvider{name: "working"}
+	chain := &providerChain{
+		providers: []WeatherProvider{failing, working},
+		threshold: 2,
+		cooldown:  time.Hour,
+	}
+
+	for i := 0; i < 4; i++ {
+		if _, err := chain.GetWeather(context.Background(), 0, 0); err != nil {
+			t.Fatalf("Expected fallback to succeed, got: %v", err)
+		}
+	}
+
+	// The failing provider should be skipped once its breaker trips
+	if failing.calls != 2 {
+		t.Errorf("Expected failing provider to be called 2 times, got %d", failing.calls)
+	}
+	if working.calls != 4 {
+		t.Errorf("Expected working provider to be called 4 times, got %d", working.calls)
+	}
+
+	// A chain with only open breakers reports an error
+	only := &providerChain{providers: []WeatherProvider{failing}, threshold: 2, cooldown: time.Hour}
+	if _, err := only.GetWeather(context.Background(), 0, 0); err == nil {
+		t.Error("Expected error when every provider is unavailable, got nil")
+	}
+}
+
+// blockingProvider waits until its context is cancelled
+type blockingProvider struct {
+	name string
+}
+
+func (p *blockingProvider) Name() string {
+	return p.name
+}
+
+func (p *blockingProvider) GetWeather(ctx context.Context, lat, lon float64) (WeatherResponse, error) {
+	<-ctx.Done()
+	return WeatherResponse{}, ctx.Err()
+}
+
+func TestProviderChainCancelled(t *testing.T) {
+	resetProviderHealth()
+	defer resetProviderHealth()
+
+	blocking := &blockingProvider{name: "blocking"}
+	fallback := &fakeProvider{name: "fallback"}
+	chain := &providerChain{providers: []WeatherProvider{blocking, fallback}, threshold: 1}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := chain.GetWeather(ctx, 0, 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected deadline exceeded, got: %v", err)
+	}
+
+	// Cancellation stops the chain and doesn't count against the provider
+	if fallback.calls != 0 {
+		t.Errorf("Expected no fallback after cancellation, got %d calls", fallback.calls)
+	}
+	if ok, _ := providerAvailable("blocking", time.Now()); !ok {
+		t.Error("Expected cancellation not to trip the breaker")
+	}
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"weathercli/units"
+)
+
+// CSV layouts: wide puts the forecast days in columns on each location's row,
+// long adds a row for each forecast day after the location's current row
+const (
+	csvLayoutWide = "wide"
+	csvLayoutLong = "long"
+)
+
+// csvOptions selects the CSV layout and, optionally, which columns are
+// written and in what order
+type csvOptions struct {
+	layout  string
+	columns []string
+}
+
+// csvOptions returns the CSV settings of the configuration
+func (c *Config) csvOptions() csvOptions {
+	return csvOptions{layout: c.CSVLayout, columns: c.CSVColumns}
+}
+
+// long reports whether the options select the long layout; wide is the
+// default
+func (o csvOptions) long() bool {
+	return o.layout == csvLayoutLong
+}
+
+// csvRow is a row of CSV output: a location's current conditions, or in the
+// long layout, one of its forecast days
+type csvRow struct {
+	data *WeatherData
+
+	// Index of the forecast day, or -1 for the current conditions
+	day int
+}
+
+// csvColumn is a CSV column. Columns of measured quantities have their unit
+// as a suffix in the header, e.g. temperature_f.
+type csvColumn struct {
+	name     string
+	unit     func(units.Spec) string
+	longOnly bool
+	value    func(row csvRow) string
+}
+
+// header returns the column's name in the header row
+func (c csvColumn) header(spec units.Spec) string {
+	if c.unit == nil {
+		return c.name
+	}
+	return c.name + "_" + c.unit(spec)
+}
+
+func temperatureSuffix(spec units.Spec) string { return spec.Temperature.Suffix() }
+func windSuffix(spec units.Spec) string        { return spec.Wind.Suffix() }
+func pressureSuffix(spec units.Spec) string    { return spec.Pressure.Suffix() }
+func precipSuffix(spec units.Spec) string      { return spec.Precipitation.Suffix() }
+
+// currentValue returns a column value of the current conditions, which is
+// empty on forecast rows
+func currentValue(value func(data *WeatherData) string) func(csvRow) string {
+	return func(row csvRow) string {
+		if row.day >= 0 {
+			return ""
+		}
+		return value(row.data)
+	}
+}
+
+// csvColumns are the named columns, other than the wide layout's forecast day
+// columns
+var csvColumns = map[string]csvColumn{
+	"record_type": {longOnly: true, value: func(row csvRow) string {
+		if row.day >= 0 {
+			return "forecast"
+		}
+		return "current"
+	}},
+	"location_id":   {value: func(row csvRow) string { return row.data.LocationID }},
+	"location_name": {value: func(row csvRow) string { return row.data.LocationName }},
+	"timestamp":     {value: func(row csvRow) string { return row.data.Timestamp.Format(time.RFC3339) }},
+	"forecast_date": {longOnly: true, value: func(row csvRow) string { return forecastValue(row.data, row.day, "date") }},
+	"temperature": {unit: temperatureSuffix, value: currentValue(func(data *WeatherData) string {
+		return formatOptional("%.1f", data.Temperature)
+	})},
+	"feels_like": {unit: temperatureSuffix, value: currentValue(func(data *WeatherData) string {
+		return formatOptional("%.1f", data.FeelsLike)
+	})},
+	"humidity": {value: currentValue(func(data *WeatherData) string {
+		return formatOptionalInt(data.Humidity)
+	})},
+	"wind_speed": {unit: windSuffix, value: currentValue(func(data *WeatherData) string {
+		return formatOptional("%.1f", data.WindSpeed)
+	})},
+	"pressure": {unit: pressureSuffix, value: currentValue(func(data *WeatherData) string {
+		return formatOptional("%.2f", data.Pressure)
+	})},
+	"condition": {value: func(row csvRow) string {
+		if row.day >= 0 {
+			return forecastValue(row.data, row.day, "condition")
+		}
+		return row.data.Condition
+	}},
+	"is_metric": {value: func(row csvRow) string { return fmt.Sprintf("%t", row.data.IsMetric) }},
+	"source":    {value: func(row csvRow) string { return row.data.Source }},
+	"station": {value: currentValue(func(data *WeatherData) string {
+		return data.Station
+	})},
+	"observed_at": {value: currentValue(func(data *WeatherData) string {
+		if data.ObservedAt == nil {
+			return ""
+		}
+		return data.ObservedAt.Format(time.RFC3339)
+	})},
+	"temp_min": {unit: temperatureSuffix, value: func(row csvRow) string {
+		if row.day >= 0 {
+			return forecastValue(row.data, row.day, "temp_min")
+		}
+		return formatOptional("%.1f", row.data.TempMin)
+	}},
+	"temp_max": {unit: temperatureSuffix, value: func(row csvRow) string {
+		if row.day >= 0 {
+			return forecastValue(row.data, row.day, "temp_max")
+		}
+		return formatOptional("%.1f", row.data.TempMax)
+	}},
+	"precipitation": {unit: precipSuffix, longOnly: true, value: func(row csvRow) string {
+		return forecastValue(row.data, row.day, "precipitation")
+	}},
+	"summary": {value: currentValue(func(data *WeatherData) string {
+		return data.Summary
+	})},
+}
+
+// csvDefaultColumns are the columns of each layout when -csv-columns isn't
+// given. The wide layout adds columns for maxForecastDays forecast days after
+// these, so its header is the same however many days were forecast.
+var csvDefaultColumns = map[string][]string{
+	csvLayoutWide: {
+		"location_id", "location_name", "timestamp",
+		"temperature", "feels_like", "humidity", "wind_speed", "pressure",
+		"condition", "is_metric", "source", "station", "observed_at",
+		"temp_min", "temp_max", "summary",
+	},
+	csvLayoutLong: {
+		"record_type", "location_id", "location_name", "timestamp", "forecast_date",
+		"temperature", "feels_like", "humidity", "wind_speed", "pressure",
+		"condition", "is_metric", "source", "station", "observed_at",
+		"temp_min", "temp_max", "precipitation", "summary",
+	},
+}
+
+// csvForecastFields are the fields of a forecast day, in the order of the
+// wide layout's day columns, with their units
+var csvForecastFields = []struct {
+	name string
+	unit func(units.Spec) string
+}{
+	{"date", nil},
+	{"temp_min", temperatureSuffix},
+	{"temp_max", temperatureSuffix},
+	{"precipitation", precipSuffix},
+	{"condition", nil},
+}
+
+// csvDayColumnPattern matches the wide layout's forecast day columns, e.g.
+// day1_temp_max
+var csvDayColumnPattern = regexp.MustCompile(`^day([1-9][0-9]*)_([a-z_]+)$`)
+
+// forecastValue formats a field of a forecast day, or returns an empty string
+// if the location has no such day
+func forecastValue(data *WeatherData, day int, field string) string {
+	if day < 0 || day >= len(data.Forecast) {
+		return ""
+	}
+	forecast := data.Forecast[day]
+	switch field {
+	case "date":
+		return forecast.Date.Format("2006-01-02")
+	case "temp_min":
+		return formatOptional("%.1f", forecast.TempMin)
+	case "temp_max":
+		return formatOptional("%.1f", forecast.TempMax)
+	case "precipitation":
+		return formatOptional("%.2f", forecast.Precipitation)
+	case "condition":
+		return forecast.Condition
+	}
+	return ""
+}
+
+// csvDayColumn returns a forecast day column of the wide layout by name
+func csvDayColumn(name string) (csvColumn, bool) {
+	match := csvDayColumnPattern.FindStringSubmatch(name)
+	if match == nil {
+		return csvColumn{}, false
+	}
+	day, err := strconv.Atoi(match[1])
+	if err != nil {
+		return csvColumn{}, false
+	}
+
+	for _, field := range csvForecastFields {
+		if field.name == match[2] {
+			fieldName := field.name
+			return csvColumn{name: name, unit: field.unit, value: func(row csvRow) string {
+				return forecastValue(row.data, day-1, fieldName)
+			}}, true
+		}
+	}
+	return csvColumn{}, false
+}
+
+// csvColumnsFor returns the columns to write for the options
+func csvColumnsFor(options csvOptions) ([]csvColumn, error) {
+	layout := csvLayoutWide
+	if options.long() {
+		layout = csvLayoutLong
+	}
+
+	names := options.columns
+	if len(names) == 0 {
+		names = append([]string(nil), csvDefaultColumns[layout]...)
+		if layout == csvLayoutWide {
+			for day := 1; day <= maxForecastDays; day++ {
+				for _, field := range csvForecastFields {
+					names = append(names, fmt.Sprintf("day%d_%s", day, field.name))
+				}
+			}
+		}
+	}
+
+	columns := make([]csvColumn, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if column, ok := csvColumns[name]; ok {
+			if column.longOnly && layout != csvLayoutLong {
+				return nil, fmt.Errorf("CSV column %s is only available with -csv-layout=long", name)
+			}
+			column.name = name
+			columns = append(columns, column)
+			continue
+		}
+		if column, ok := csvDayColumn(name); ok {
+			if layout != csvLayoutWide {
+				return nil, fmt.Errorf("CSV column %s is only available with -csv-layout=wide", name)
+			}
+			columns = append(columns, column)
+			continue
+		}
+		return nil, fmt.Errorf("unknown CSV column: %s", name)
+	}
+	return columns, nil
+}
+
+// validateCSVOptions checks the CSV layout and column selection
+func validateCSVOptions(options csvOptions) error {
+	switch options.layout {
+	case "", csvLayoutWide, csvLayoutLong:
+	default:
+		return fmt.Errorf("invalid CSV layout: %s (use wide or long)", options.layout)
+	}
+	_, err := csvColumnsFor(options)
+	return err
+}
+
+// OutputCSVFormat writes weather data in CSV format
+func OutputCSVFormat(output io.Writer, dataList []WeatherData, options csvOptions) error {
+	columns, err := csvColumnsFor(options)
+	if err != nil {
+		return err
+	}
+
+	writer := csv.NewWriter(output)
+
+	// Write header, with unit suffixes on measured columns
+	spec := dataList[0].Units
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.header(spec)
+	}
+	if err := writer.Write(header); err != nil {
+		return fmt.Errorf("error writing CSV header: %w", err)
+	}
+
+	// Write data rows: the current conditions of each location, followed by
+	// its forecast days in the long layout
+	for i := range dataList {
+		rows := []csvRow{{data: &dataList[i], day: -1}}
+		if options.long() {
+			for day := range dataList[i].Forecast {
+				rows = append(rows, csvRow{data: &dataList[i], day: day})
+			}
+		}
+
+		for _, row := range rows {
+			record := make([]string, len(columns))
+			for j, column := range columns {
+				record[j] = column.value(row)
+			}
+			if err := writer.Write(record); err != nil {
+				return fmt.Errorf("error writing CSV row: %w", err)
+			}
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"weathercli/units"
+)
+
+// csvTestData returns a record with two forecast days
+func csvTestData() WeatherData {
+	data := WeatherData{
+		LocationID:   "zip:80202",
+		LocationName: "Denver",
+		Timestamp:    time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC),
+		Temperature:  ptr(68.0),
+		TempMin:      ptr(45.0),
+		TempMax:      ptr(72.0),
+		Condition:    "Sunny",
+		Summary:      "Clear and mild.",
+		Units:        units.Imperial(),
+	}
+	data.Forecast = make([]struct {
+		Date          time.Time `json:"date"`
+		TempMin       *float64  `json:"temp_min"`
+		TempMax       *float64  `json:"temp_max"`
+		Condition     string    `json:"condition"`
+		Precipitation *float64  `json:"precipitation"`
+	}, 2)
+	for i := range data.Forecast {
+		data.Forecast[i].Date = time.Date(2026, 10, 16+i, 0, 0, 0, 0, time.UTC)
+		data.Forecast[i].TempMin = ptr(45 + float64(i))
+		data.Forecast[i].TempMax = ptr(72 + float64(i))
+		data.Forecast[i].Condition = "Sunny"
+	}
+	data.Forecast[1].Condition = "Rain"
+	data.Forecast[1].Precipitation = ptr(0.25)
+	return data
+}
+
+// writeTestCSV writes records with the options and parses them back into
+// rows of cells by header
+func writeTestCSV(t *testing.T, dataList []WeatherData, options csvOptions) ([]string, []map[string]string) {
+	t.Helper()
+	var b strings.Builder
+	if err := OutputCSVFormat(&b, dataList, options); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	records, err := csv.NewReader(strings.NewReader(b.String())).ReadAll()
+	if err != nil {
+		t.Fatalf("Expected valid CSV, got: %v", err)
+	}
+
+	var rows []map[string]string
+	for _, record := range records[1:] {
+		row := make(map[string]string)
+		for i, column := range records[0] {
+			row[column] = record[i]
+		}
+		rows = append(rows, row)
+	}
+	return records[0], rows
+}
+
+func TestCSVWideLayout(t *testing.T) {
+	header, rows := writeTestCSV(t, []WeatherData{csvTestData()}, csvOptions{})
+
+	// The existing columns come first, so readers of older output still work
+	if strings.Join(header[:4], ",") != "location_id,location_name,timestamp,temperature_f" {
+		t.Errorf("Unexpected leading columns: %v", header[:4])
+	}
+	if len(rows) != 1 {
+		t.Fatalf("Expected one row, got %d", len(rows))
+	}
+	row := rows[0]
+	if row["temp_min_f"] != "45.0" || row["temp_max_f"] != "72.0" || row["summary"] != "Clear and mild." {
+		t.Errorf("Expected today's range and the summary, got %q, %q and %q", row["temp_min_f"], row["temp_max_f"], row["summary"])
+	}
+	if row["day2_date"] != "2026-10-17" || row["day2_temp_max_f"] != "73.0" || row["day2_precipitation_in"] != "0.25" || row["day2_condition"] != "Rain" {
+		t.Errorf("Unexpected second forecast day: %v", row)
+	}
+	if date, ok := row["day3_date"]; !ok || date != "" {
+		t.Errorf("Expected an empty column for a day that wasn't forecast, got %q", date)
+	}
+
+	// The header doesn't depend on how many days were forecast
+	other, _ := writeTestCSV(t, []WeatherData{{LocationID: "zip:10001", Units: csvTestData().Units}}, csvOptions{})
+	if strings.Join(other, ",") != strings.Join(header, ",") {
+		t.Errorf("Expected the same header without a forecast, got %v", other)
+	}
+	if last := header[len(header)-1]; last != fmt.Sprintf("day%d_condition", maxForecastDays) {
+		t.Errorf("Expected the columns to end with the last forecast day, got %s", last)
+	}
+}
+
+func TestCSVLongLayout(t *testing.T) {
+	header, rows := writeTestCSV(t, []WeatherData{csvTestData()}, csvOptions{layout: csvLayoutLong})
+
+	if header[0] != "record_type" {
+		t.Errorf("Expected record_type first, got %v", header)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("Expected a current row and 2 forecast rows, got %d", len(rows))
+	}
+
+	current := rows[0]
+	if current["record_type"] != "current" || current["forecast_date"] != "" || current["temperature_f"] != "68.0" {
+		t.Errorf("Unexpected current row: %v", current)
+	}
+
+	forecast := rows[2]
+	if forecast["record_type"] != "forecast" || forecast["location_id"] != "zip:80202" || forecast["forecast_date"] != "2026-10-17" {
+		t.Errorf("Unexpected forecast row: %v", forecast)
+	}
+	if forecast["temp_min_f"] != "46.0" || forecast["precipitation_in"] != "0.25" || forecast["condition"] != "Rain" {
+		t.Errorf("Expected the forecast day's values, got %v", forecast)
+	}
+	if forecast["temperature_f"] != "" || forecast["summary"] != "" {
+		t.Errorf("Expected current conditions to be empty on forecast rows, got %v", forecast)
+	}
+}
+
+func TestCSVColumns(t *testing.T) {
+	options := csvOptions{columns: []string{"location_name", "day1_temp_max", "temperature"}}
+	header, rows := writeTestCSV(t, []WeatherData{csvTestData()}, options)
+
+	if strings.Join(header, ",") != "location_name,day1_temp_max_f,temperature_f" {
+		t.Errorf("Expected the selected columns in order, got %v", header)
+	}
+	if rows[0]["day1_temp_max_f"] != "72.0" {
+		t.Errorf("Expected the first day's high, got %v", rows[0])
+	}
+
+	invalid := []csvOptions{
+		{layout: "tall"},
+		{columns: []string{"dew_point"}},
+		{columns: []string{"record_type"}},
+		{layout: csvLayoutLong, columns: []string{"day1_date"}},
+		{columns: []string{"day0_date"}},
+		{columns: []string{"day1_humidity"}},
+	}
+	for _, options := range invalid {
+		if err := validateCSVOptions(options); err == nil {
+			t.Errorf("Expected layout %q with columns %v to be rejected", options.layout, options.columns)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Default base URLs of the upstream APIs
+const (
+	defaultOWMBaseURL                = "https://api.openweathermap.org"
+	defaultNWSBaseURL                = "https://api.weather.gov"
+	defaultOpenMeteoBaseURL          = "https://api.open-meteo.com"
+	defaultOpenMeteoGeocodingBaseURL = "https://geocoding-api.open-meteo.com"
+	defaultMetNoBaseURL              = "https://api.met.no"
+	defaultOpenAIBaseURL             = "https://api.openai.com/v1"
+)
+
+// Endpoint paths, relative to each API's base URL
+const (
+	// OpenWeatherMap geocoding and One Call endpoints
+	geoEndpoint          = "/geo/1.0/zip"
+	owmDirectGeoEndpoint = "/geo/1.0/direct"
+	weatherEndpoint      = "/data/3.0/onecall"
+
+	// National Weather Service API endpoints
+	nwsPointsEndpoint   = "/points"
+	nwsStationsEndpoint = "/stations"
+	nwsAlertsEndpoint   = "/alerts/active"
+
+	// Open-Meteo forecast and geocoding endpoints (no API key required)
+	openMeteoEndpoint          = "/v1/forecast"
+	openMeteoGeocodingEndpoint = "/v1/search"
+
+	// MET Norway Locationforecast 2.0 endpoint (no API key required)
+	metNoEndpoint = "/weatherapi/locationforecast/2.0/compact"
+)
+
+// defaultAllowedHosts are the hosts upstream requests may go to unless
+// -allow-hosts says otherwise. Subdomains of each host are allowed too.
+var defaultAllowedHosts = []string{
+	"openweathermap.org",
+	"api.weather.gov",
+	"open-meteo.com",
+	"api.met.no",
+	"api.openai.com",
+}
+
+// Endpoints holds the base URL of each upstream API
+type Endpoints struct {
+	OWM                string
+	NWS                string
+	OpenMeteo          string
+	OpenMeteoGeocoding string
+	MetNo              string
+	OpenAI             string
+}
+
+// URLPolicy decides which URLs upstream requests may be sent to
+type URLPolicy struct {
+	// AllowedHosts lists the permitted hosts; subdomains are also permitted
+	AllowedHosts []string
+
+	// AllowHTTP permits plain HTTP, e.g. for a local stand-in server
+	AllowHTTP bool
+}
+
+// endpoints, urlPolicy and userAgent are used by every provider and geocoder.
+// They are set from the configuration by ConfigureEndpoints before any
+// requests are made.
+var (
+	endpoints = (&Config{}).Endpoints()
+	urlPolicy = (&Config{}).URLPolicy()
+	userAgent = defaultUserAgent
+)
+
+// ConfigureEndpoints applies the configured base URLs, URL policy and
+// User-Agent
+func ConfigureEndpoints(config *Config) {
+	endpoints = config.Endpoints()
+	urlPolicy = config.URLPolicy()
+	userAgent = defaultUserAgent
+	if config.UserAgent != "" {
+		userAgent = config.UserAgent
+	}
+}
+
+// Endpoints returns the configured base URLs, using the public APIs for any
+// that aren't overridden
+func (c *Config) Endpoints() Endpoints {
+	baseURL := func(configured, fallback string) string {
+		if configured == "" {
+			return fallback
+		}
+		return strings.TrimRight(configured, "/")
+	}
+
+	return Endpoints{
+		OWM:                baseURL(c.OWMBaseURL, defaultOWMBaseURL),
+		NWS:                baseURL(c.NWSBaseURL, defaultNWSBaseURL),
+		OpenMeteo:          baseURL(c.OpenMeteoBaseURL, defaultOpenMeteoBaseURL),
+		OpenMeteoGeocoding: baseURL(c.OpenMeteoGeocodingBaseURL, defaultOpenMeteoGeocodingBaseURL),
+		MetNo:              baseURL(c.MetNoBaseURL, defaultMetNoBaseURL),
+		OpenAI:             baseURL(c.OpenAIBaseURL, defaultOpenAIBaseURL),
+	}
+}
+
+// URLPolicy returns the configured URL policy
+func (c *Config) URLPolicy() URLPolicy {
+	hosts := c.AllowedHosts
+	if len(hosts) == 0 {
+		hosts = defaultAllowedHosts
+	}
+	return URLPolicy{AllowedHosts: hosts, AllowHTTP: c.AllowHTTP}
+}
+
+// Check returns an error if a URL may not be requested
+func (p URLPolicy) Check(rawURL string) error {
+	parsedURL, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid URL: %w", err)
+	}
+
+	switch {
+	case parsedURL.Scheme == "https":
+	case parsedURL.Scheme == "http" && p.AllowHTTP:
+	default:
+		return fmt.Errorf("URL must use HTTPS")
+	}
+
+	host := strings.ToLower(parsedURL.Hostname())
+	for _, allowed := range p.AllowedHosts {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return nil
+		}
+	}
+	return fmt.Errorf("URL host not allowed: %s", parsedURL.Host)
+}
+
+// validateURL checks a URL against the configured policy
+func validateURL(rawURL string) error {
+	return urlPolicy.Check(rawURL)
+}
+
+// validateEndpoints checks that every configured base URL is allowed
+func validateEndpoints(config *Config) error {
+	policy := config.URLPolicy()
+	e := config.Endpoints()
+
+	for _, endpoint := range []struct{ flag, url string }{
+		{"owm-base-url", e.OWM},
+		{"nws-base-url", e.NWS},
+		{"open-meteo-base-url", e.OpenMeteo},
+		{"open-meteo-geocoding-base-url", e.OpenMeteoGeocoding},
+		{"met-no-base-url", e.MetNo},
+		{"openai-base-url", e.OpenAI},
+	} {
+		if err := policy.Check(endpoint.url); err != nil {
+			return fmt.Errorf("-%s %s: %w (see -allow-hosts and -allow-http)", endpoint.flag, endpoint.url, err)
+		}
+	}
+	return nil
+}
+
+// nwsURL rewrites a URL returned by the NWS API, such as a forecast or
+// station URL, onto the configured NWS base URL so that follow-up requests go
+// through the same stand-in or proxy
+func nwsURL(rawURL string) string {
+	if endpoints.NWS == defaultNWSBaseURL {
+		return rawURL
+	}
+	if rest, ok := strings.CutPrefix(rawURL, defaultNWSBaseURL); ok {
+		return endpoints.NWS + rest
+	}
+	return rawURL
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestURLPolicy(t *testing.T) {
+	policy := (&Config{}).URLPolicy()
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://api.openweathermap.org/data/3.0/onecall", true},
+		{"https://api.weather.gov/points/39.7,-104.9", true},
+		{"https://geocoding-api.open-meteo.com/v1/search", true},
+		{"https://api.met.no/weatherapi/locationforecast/2.0/compact", true},
+		{"http://api.weather.gov/points/39.7,-104.9", false},
+		{"https://evilopenweathermap.org/data", false},
+		{"https://api.weather.gov.example.com/points", false},
+		{"https://127.0.0.1:8080/points", false},
+	}
+
+	for _, test := range tests {
+		err := policy.Check(test.url)
+		if test.allowed && err != nil {
+			t.Errorf("Expected %s to be allowed, got: %v", test.url, err)
+		}
+		if !test.allowed && err == nil {
+			t.Errorf("Expected %s to be rejected", test.url)
+		}
+	}
+
+	// An explicit allowlist replaces the defaults
+	policy = (&Config{AllowedHosts: []string{"127.0.0.1"}, AllowHTTP: true}).URLPolicy()
+	if err := policy.Check("http://127.0.0.1:8080/points"); err != nil {
+		t.Errorf("Expected stand-in server to be allowed, got: %v", err)
+	}
+	if err := policy.Check("https://api.weather.gov/points"); err == nil {
+		t.Error("Expected hosts outside the allowlist to be rejected")
+	}
+}
+
+func TestValidateEndpoints(t *testing.T) {
+	if err := validateEndpoints(&Config{}); err != nil {
+		t.Errorf("Expected default endpoints to be valid, got: %v", err)
+	}
+
+	config := &Config{NWSBaseURL: "http://127.0.0.1:8080"}
+	if err := validateEndpoints(config); err == nil {
+		t.Error("Expected a base URL outside the allowlist to be rejected")
+	}
+
+	config.AllowedHosts = append([]string{"127.0.0.1"}, defaultAllowedHosts...)
+	config.AllowHTTP = true
+	if err := validateEndpoints(config); err != nil {
+		t.Errorf("Expected allowed base URL to be valid, got: %v", err)
+	}
+}
+
+func TestNWSWeatherStandIn(t *testing.T) {
+	mux := http.NewServeMux()
+
+	// The stand-in returns the real API's URLs, as a caching proxy would
+	mux.HandleFunc("/points/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"properties": {
+			"forecast": "https://api.weather.gov/gridpoints/BOU/62,60/forecast",
+			"forecastHourly": "https://api.weather.gov/gridpoints/BOU/62,60/forecast/hourly",
+			"observationStations": "https://api.weather.gov/gridpoints/BOU/62,60/stations"
+		}}`)) //nolint
+	})
+	mux.HandleFunc("/gridpoints/BOU/62,60/forecast", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"properties": {"periods": [
+			{"startTime": "2024-06-01T06:00:00-06:00", "temperature": 77, "temperatureUnit": "F", "shortForecast": "Sunny", "isDaytime": true},
+			{"startTime": "2024-06-02T18:00:00-06:00", "temperature": 50, "temperatureUnit": "F", "shortForecast": "Clear", "isDaytime": false}
+		]}}`)) //nolint
+	})
+	mux.HandleFunc("/gridpoints/BOU/62,60/stations", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"features": [{"properties": {"stationIdentifier": "KDEN"}}]}`)) //nolint
+	})
+	mux.HandleFunc("/stations/KDEN/observations/latest", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"properties": {
+			"timestamp": "` + time.Now().UTC().Format(time.RFC3339) + `",
+			"temperature": {"value": 21.5},
+			"windSpeed": {"value": 18, "unitCode": "wmoUnit:km_h-1"},
+			"relativeHumidity": {"value": 40},
+			"textDescription": "Clear"
+		}}`)) //nolint
+	})
+
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	defer func(e Endpoints, p URLPolicy) { endpoints, urlPolicy = e, p }(endpoints, urlPolicy)
+	ConfigureEndpoints(&Config{NWSBaseURL: server.URL, AllowedHosts: []string{"127.0.0.1"}, AllowHTTP: true})
+
+	weather, err := getNWSWeather(context.Background(), 39.7, -104.9, nil, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if *weather.Current.Temp != 21.5 || *weather.Current.WindSpeed != 5 {
+		t.Errorf("Expected 21.5°C and 5 m/s, got %v°C and %v m/s", *weather.Current.Temp, *weather.Current.WindSpeed)
+	}
+	if len(weather.Daily) != 2 || *weather.Daily[0].Temp.Max != 25 {
+		t.Fatalf("Expected two forecast days, the first with a high of 25°C, got %+v", weather.Daily)
+	}
+
+	// A day with only a day or a night period has no low or high
+	if weather.Daily[0].Temp.Min != nil || weather.Daily[1].Temp.Max != nil || *weather.Daily[1].Temp.Min != 10 {
+		t.Errorf("Expected a high only on the first day and a low of 10°C only on the second, got %+v", weather.Daily)
+	}
+
+	// The stand-in has no hourly forecast, which doesn't fail the response
+	weather, err = getNWSWeather(context.Background(), 39.7, -104.9, nil, true)
+	if err != nil {
+		t.Fatalf("Expected no error without the hourly forecast, got: %v", err)
+	}
+	if weather.Hourly != nil || len(weather.Daily) != 2 {
+		t.Errorf("Expected the daily forecast and no hourly forecast, got %d days and %d hours", len(weather.Daily), len(weather.Hourly))
+	}
+}
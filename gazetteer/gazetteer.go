@@ -0,0 +1,102 @@
+// Package gazetteer provides offline ZIP code lookups from an embedded copy of
+// the Census Bureau ZCTA gazetteer, joined with city and state names.
+package gazetteer
+
+import (
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+)
+
+//go:generate go run gen.go -zcta https://www2.census.gov/geo/docs/maps-data/data/gazetteer/2023_Gazetteer/2023_Gaz_zcta_national.zip -places https://download.geonames.org/export/zip/US.zip -out zcta.csv.gz
+
+// zctaData is a gzip-compressed CSV with the columns zip, lat, lon, city and
+// state. It is produced by gen.go.
+//
+//go:embed zcta.csv.gz
+var zctaData []byte
+
+// Place is a ZIP code with its internal point coordinates
+type Place struct {
+	ZIP   string
+	Lat   float64
+	Lon   float64
+	City  string
+	State string
+}
+
+var (
+	loadOnce sync.Once
+	places   map[string]Place
+	loadErr  error
+)
+
+// load parses the embedded data on first use
+func load() {
+	places, loadErr = parse(zctaData)
+}
+
+// parse decodes the compressed CSV gazetteer
+func parse(data []byte) (map[string]Place, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error opening gazetteer: %w", err)
+	}
+	defer gz.Close()
+
+	reader := csv.NewReader(gz)
+	reader.FieldsPerRecord = 5
+	reader.ReuseRecord = true
+
+	result := make(map[string]Place)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading gazetteer: %w", err)
+		}
+
+		lat, err := strconv.ParseFloat(record[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid latitude for %s: %w", record[0], err)
+		}
+		lon, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid longitude for %s: %w", record[0], err)
+		}
+
+		result[record[0]] = Place{
+			ZIP:   record[0],
+			Lat:   lat,
+			Lon:   lon,
+			City:  record[3],
+			State: record[4],
+		}
+	}
+
+	return result, nil
+}
+
+// Lookup returns the place for a five-digit ZIP code
+func Lookup(zip string) (Place, bool, error) {
+	loadOnce.Do(load)
+	if loadErr != nil {
+		return Place{}, false, loadErr
+	}
+
+	place, ok := places[zip]
+	return place, ok, nil
+}
+
+// Len returns the number of ZIP codes in the gazetteer
+func Len() int {
+	loadOnce.Do(load)
+	return len(places)
+}
@@ -0,0 +1,49 @@
+package gazetteer
+
+import (
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	place, ok, err := Lookup("90210")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !ok {
+		t.Fatal("Expected 90210 to be in the gazetteer")
+	}
+	if place.City != "Beverly Hills" || place.State != "CA" {
+		t.Errorf("Expected Beverly Hills, CA, got %s, %s", place.City, place.State)
+	}
+	if place.Lat < 34 || place.Lat > 35 || place.Lon < -119 || place.Lon > -118 {
+		t.Errorf("Unexpected coordinates for 90210: %v, %v", place.Lat, place.Lon)
+	}
+
+	// ZIP codes with a leading zero are kept as strings
+	if _, ok, _ := Lookup("02108"); !ok {
+		t.Error("Expected 02108 to be in the gazetteer")
+	}
+
+	if _, ok, _ := Lookup("00000"); ok {
+		t.Error("Expected 00000 not to be in the gazetteer")
+	}
+}
+
+func TestLookupFullTable(t *testing.T) {
+	// The full table has every ZCTA, over 33,000 of them; a partial build
+	// only has a handful of ZIP codes
+	if Len() < 30000 {
+		t.Fatalf("Expected the full table, got only %d ZIP codes; run go generate ./gazetteer", Len())
+	}
+
+	place, ok, err := Lookup("80202")
+	if err != nil || !ok {
+		t.Fatalf("Expected 80202 to be in the gazetteer, got %v", err)
+	}
+	if place.City != "Denver" || place.State != "CO" {
+		t.Errorf("Expected Denver, CO, got %s, %s", place.City, place.State)
+	}
+	if place.Lat < 39 || place.Lat > 40 || place.Lon < -106 || place.Lon > -104 {
+		t.Errorf("Unexpected coordinates for 80202: %v, %v", place.Lat, place.Lon)
+	}
+}
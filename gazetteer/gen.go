@@ -0,0 +1,144 @@
+//go:build ignore
+
+// gen.go builds zcta.csv.gz from the Census Bureau ZCTA gazetteer and the
+// GeoNames US postal code table, which supplies city and state names.
+//
+// The inputs are given as local files or as the URLs of the zip archives
+// they are published in, which go generate downloads:
+//
+//	https://www2.census.gov/geo/docs/maps-data/data/gazetteer/2023_Gazetteer/2023_Gaz_zcta_national.zip
+//	https://download.geonames.org/export/zip/US.zip
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+type place struct {
+	lat, lon    string
+	city, state string
+}
+
+func main() {
+	zctaPath := flag.String("zcta", "", "Census ZCTA gazetteer file (tab-separated), or the URL of its zip archive")
+	placesPath := flag.String("places", "", "GeoNames US postal code file (tab-separated), or the URL of its zip archive")
+	outPath := flag.String("out", "zcta.csv.gz", "Output file")
+	flag.Parse()
+
+	places := make(map[string]place)
+
+	// GeoNames: country, zip, city, state name, state code, county, county code,
+	// community, community code, lat, lon, accuracy
+	readTSV(*placesPath, func(fields []string) {
+		if len(fields) < 11 {
+			return
+		}
+		places[fields[1]] = place{lat: fields[9], lon: fields[10], city: fields[2], state: fields[4]}
+	})
+
+	// Census: GEOID, ALAND, AWATER, ALAND_SQMI, AWATER_SQMI, INTPTLAT, INTPTLONG.
+	// Prefer the ZCTA internal point over the GeoNames coordinates.
+	readTSV(*zctaPath, func(fields []string) {
+		if len(fields) < 7 || fields[0] == "GEOID" {
+			return
+		}
+		zip := strings.TrimSpace(fields[0])
+		p := places[zip]
+		p.lat = strings.TrimSpace(fields[5])
+		p.lon = strings.TrimSpace(fields[6])
+		places[zip] = p
+	})
+
+	zips := make([]string, 0, len(places))
+	for zip := range places {
+		zips = append(zips, zip)
+	}
+	sort.Strings(zips)
+
+	out, err := os.Create(*outPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	writer := csv.NewWriter(gz)
+	for _, zip := range zips {
+		p := places[zip]
+		if err := writer.Write([]string{zip, p.lat, p.lon, p.city, p.state}); err != nil {
+			log.Fatal(err)
+		}
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		log.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Wrote %d ZIP codes to %s", len(zips), *outPath)
+}
+
+// readTSV calls fn for each line of a tab-separated file
+func readTSV(path string, fn func(fields []string)) {
+	file, err := openSource(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fn(strings.Split(scanner.Text(), "\t"))
+	}
+	if err := scanner.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// openSource opens a local file, or downloads a zip archive and opens the
+// text file in it named like the archive, e.g. US.txt in US.zip
+func openSource(source string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(source, "https://") {
+		return os.Open(source)
+	}
+
+	resp, err := http.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s: status code %d", source, resp.StatusCode)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSuffix(path.Base(source), ".zip") + ".txt"
+	for _, file := range archive.File {
+		if path.Base(file.Name) == name {
+			return file.Open()
+		}
+	}
+	return nil, fmt.Errorf("%s has no %s", source, name)
+}
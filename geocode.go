@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Geocoder resolves a Location to coordinates and a display name
+type Geocoder interface {
+	Geocode(ctx context.Context, loc Location) (float64, float64, string, error)
+}
+
+// NewGeocoder returns the geocoder for the configuration. OpenWeatherMap is
+// used for ZIP codes and city names when an API key is set; otherwise ZIP
+// codes come from the offline gazetteer and city names from Open-Meteo.
+// ZIP codes missing from the gazetteer are only sent to the Open-Meteo
+// postal code search with -zip-search. Results are cached on disk when a cache
+// directory is configured.
+func NewGeocoder(config *Config) (Geocoder, error) {
+	geocoder := &defaultGeocoder{apiKey: config.APIKey, zipSearch: config.ZipSearch}
+
+	cache, err := configCache(config)
+	if err != nil || cache == nil {
+		return geocoder, err
+	}
+
+	source := "keyless"
+	if config.APIKey != "" {
+		source = "owm"
+	}
+	return &cachedGeocoder{geocoder: geocoder, cache: cache, source: source}, nil
+}
+
+// defaultGeocoder dispatches on the location kind
+type defaultGeocoder struct {
+	apiKey    string
+	zipSearch bool
+}
+
+func (g *defaultGeocoder) Geocode(ctx context.Context, loc Location) (float64, float64, string, error) {
+	switch loc.Kind {
+	case LocationZip:
+		lat, lon, name, err := getCoordinates(ctx, loc.ZIP, g.apiKey)
+		if errors.Is(err, errUnknownZIP) && g.zipSearch {
+			return getOpenMeteoZipCoordinates(ctx, loc.ZIP)
+		}
+		return lat, lon, name, err
+	case LocationCoords:
+		return loc.Lat, loc.Lon, loc.Label(), nil
+	case LocationCity:
+		if g.apiKey != "" {
+			return getOWMCityCoordinates(ctx, loc.City, loc.Region, g.apiKey)
+		}
+		return getOpenMeteoCityCoordinates(ctx, loc.City, loc.Region)
+	case LocationStation:
+		return getNWSStationCoordinates(ctx, loc.Station)
+	default:
+		return 0, 0, "", fmt.Errorf("unsupported location: %s", loc)
+	}
+}
+
+// usStates maps US state and territory codes to their names
+var usStates = map[string]string{
+	"AL": "Alabama", "AK": "Alaska", "AZ": "Arizona", "AR": "Arkansas",
+	"CA": "California", "CO": "Colorado", "CT": "Connecticut", "DE": "Delaware",
+	"DC": "District of Columbia", "FL": "Florida", "GA": "Georgia", "HI": "Hawaii",
+	"ID": "Idaho", "IL": "Illinois", "IN": "Indiana", "IA": "Iowa",
+	"KS": "Kansas", "KY": "Kentucky", "LA": "Louisiana", "ME": "Maine",
+	"MD": "Maryland", "MA": "Massachusetts", "MI": "Michigan", "MN": "Minnesota",
+	"MS": "Mississippi", "MO": "Missouri", "MT": "Montana", "NE": "Nebraska",
+	"NV": "Nevada", "NH": "New Hampshire", "NJ": "New Jersey", "NM": "New Mexico",
+	"NY": "New York", "NC": "North Carolina", "ND": "North Dakota", "OH": "Ohio",
+	"OK": "Oklahoma", "OR": "Oregon", "PA": "Pennsylvania", "RI": "Rhode Island",
+	"SC": "South Carolina", "SD": "South Dakota", "TN": "Tennessee", "TX": "Texas",
+	"UT": "Utah", "VT": "Vermont", "VA": "Virginia", "WA": "Washington",
+	"WV": "West Virginia", "WI": "Wisconsin", "WY": "Wyoming", "PR": "Puerto Rico",
+	"GU": "Guam", "VI": "U.S. Virgin Islands", "AS": "American Samoa",
+	"MP": "Northern Mariana Islands",
+}
+
+// getOWMCityCoordinates resolves a city name with the OpenWeatherMap direct
+// geocoding API. Two-letter US state codes are qualified with the country.
+func getOWMCityCoordinates(ctx context.Context, city, region, apiKey string) (float64, float64, string, error) {
+	query := city
+	if region != "" {
+		query += "," + region
+		if _, ok := usStates[strings.ToUpper(region)]; ok {
+			query += ",US"
+		}
+	}
+
+	urlStr := fmt.Sprintf("%s%s?q=%s&limit=1&appid=%s", endpoints.OWM, owmDirectGeoEndpoint, url.QueryEscape(query), apiKey)
+
+	if err := validateURL(urlStr); err != nil {
+		return 0, 0, "", fmt.Errorf("URL validation failed: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("error getting geocode: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, "", fmt.Errorf("geocoding API error: status code %d", resp.StatusCode)
+	}
+
+	var results []GeoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		return 0, 0, "", fmt.Errorf("error decoding geocode response: %w", err)
+	}
+	if len(results) == 0 {
+		return 0, 0, "", fmt.Errorf("city not found: %s", query)
+	}
+	return results[0].Lat, results[0].Lon, results[0].Name, nil
+}
+
+// OpenMeteoGeocodingResponse is the Open-Meteo geocoding search response
+type OpenMeteoGeocodingResponse struct {
+	Results []struct {
+		Name        string  `json:"name"`
+		Latitude    float64 `json:"latitude"`
+		Longitude   float64 `json:"longitude"`
+		CountryCode string  `json:"country_code"`
+		Country     string  `json:"country"`
+		Admin1      string  `json:"admin1"`
+	} `json:"results"`
+}
+
+// getOpenMeteoCityCoordinates resolves a city name with the Open-Meteo
+// geocoding API
+func getOpenMeteoCityCoordinates(ctx context.Context, city, region string) (float64, float64, string, error) {
+	urlStr := fmt.Sprintf("%s%s?name=%s&count=10&language=en&format=json", endpoints.OpenMeteoGeocoding, openMeteoGeocodingEndpoint, url.QueryEscape(city))
+
+	if err := validateURL(urlStr); err != nil {
+		return 0, 0, "", fmt.Errorf("URL validation failed: %w", err)
+	}
+
+	return fetchOpenMeteoCityCoordinates(ctx, urlStr, city, region)
+}
+
+// getOpenMeteoZipCoordinates resolves a US ZIP code with the Open-Meteo
+// geocoding API, which also searches postal codes
+func getOpenMeteoZipCoordinates(ctx context.Context, zip string) (float64, float64, string, error) {
+	urlStr := fmt.Sprintf("%s%s?name=%s&count=1&countryCode=US&language=en&format=json", endpoints.OpenMeteoGeocoding, openMeteoGeocodingEndpoint, url.QueryEscape(zip))
+
+	if err := validateURL(urlStr); err != nil {
+		return 0, 0, "", fmt.Errorf("URL validation failed: %w", err)
+	}
+
+	lat, lon, name, err := fetchOpenMeteoCityCoordinates(ctx, urlStr, zip, "US")
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("%w: %s (%v)", errUnknownZIP, zip, err)
+	}
+	return lat, lon, name, nil
+}
+
+// fetchOpenMeteoCityCoordinates requests an Open-Meteo geocoding URL and picks
+// the first result matching the region, if one was given
+func fetchOpenMeteoCityCoordinates(ctx context.Context, urlStr, city, region string) (float64, float64, string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("error getting geocode: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, "", fmt.Errorf("Open-Meteo geocoding API error: status code %d", resp.StatusCode)
+	}
+
+	var data OpenMeteoGeocodingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return 0, 0, "", fmt.Errorf("error decoding geocode response: %w", err)
+	}
+
+	for _, result := range data.Results {
+		if region == "" || matchesRegion(region, result.CountryCode, result.Country, result.Admin1) {
+			return result.Latitude, result.Longitude, result.Name, nil
+		}
+	}
+
+	if region != "" {
+		return 0, 0, "", fmt.Errorf("city not found: %s, %s", city, region)
+	}
+	return 0, 0, "", fmt.Errorf("city not found: %s", city)
+}
+
+// matchesRegion reports whether a region qualifier such as "CO", "Colorado",
+// "FR" or "France" matches a geocoding result
+func matchesRegion(region, countryCode, country, admin1 string) bool {
+	if strings.EqualFold(region, countryCode) || strings.EqualFold(region, country) || strings.EqualFold(region, admin1) {
+		return true
+	}
+	state, ok := usStates[strings.ToUpper(region)]
+	return ok && strings.EqualFold(countryCode, "US") && strings.EqualFold(state, admin1)
+}
+
+// NWSStationResponse is the NWS response for a single observation station
+type NWSStationResponse struct {
+	Geometry struct {
+		Coordinates []float64 `json:"coordinates"`
+	} `json:"geometry"`
+	Properties struct {
+		Name string `json:"name"`
+	} `json:"properties"`
+}
+
+// getNWSStationCoordinates looks up an ICAO station with the NWS API
+func getNWSStationCoordinates(ctx context.Context, station string) (float64, float64, string, error) {
+	urlStr := fmt.Sprintf("%s%s/%s", endpoints.NWS, nwsStationsEndpoint, url.PathEscape(station))
+
+	if err := validateURL(urlStr); err != nil {
+		return 0, 0, "", fmt.Errorf("URL validation failed: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("error fetching NWS station: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return 0, 0, "", fmt.Errorf("unknown station: %s", station)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, 0, "", fmt.Errorf("NWS stations API error: status code %d", resp.StatusCode)
+	}
+
+	var data NWSStationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return 0, 0, "", fmt.Errorf("error decoding NWS station response: %w", err)
+	}
+
+	// GeoJSON coordinates are ordered longitude, latitude
+	if len(data.Geometry.Coordinates) < 2 {
+		return 0, 0, "", fmt.Errorf("NWS station %s has no coordinates", station)
+	}
+	return data.Geometry.Coordinates[1], data.Geometry.Coordinates[0], data.Properties.Name, nil
+}
@@ -2,4 +2,27 @@ module weathercli
 
 go 1.21
 
-require github.com/sashabaranov/go-openai v1.40.5
+require (
+	github.com/bradfitz/latlong v0.0.0-20170410180902-f3db6d0dff40
+	github.com/klauspost/compress v1.17.11
+	github.com/parquet-go/parquet-go v0.23.0
+	github.com/sashabaranov/go-openai v1.40.5
+	github.com/twmb/franz-go v1.18.1
+	github.com/twmb/franz-go/pkg/kfake v0.0.0-20250320172111-35ab5e5f5327
+)
+
+require (
+	github.com/andybalholm/brotli v1.1.0 // indirect
+	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/jonas-p/go-shp v0.1.1 // indirect
+	github.com/mattn/go-runewidth v0.0.15 // indirect
+	github.com/olekukonko/tablewriter v0.0.5 // indirect
+	github.com/pierrec/lz4/v4 v4.1.22 // indirect
+	github.com/rivo/uniseg v0.4.7 // indirect
+	github.com/segmentio/encoding v0.4.0 // indirect
+	github.com/twmb/franz-go/pkg/kmsg v1.9.0 // indirect
+	golang.org/x/crypto v0.32.0 // indirect
+	golang.org/x/image v0.24.0 // indirect
+	golang.org/x/sys v0.29.0 // indirect
+)
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Default maximum requests per second to each upstream host
+	defaultRateLimit = 5.0
+
+	// Default connect and read timeouts for upstream requests
+	defaultConnectTimeout = 10 * time.Second
+	defaultReadTimeout    = 30 * time.Second
+
+	// Default number of retries after a failed attempt
+	defaultMaxRetries = 3
+
+	// Backoff before the first retry, and the cap for any single wait
+	// including Retry-After
+	retryBaseDelay = 500 * time.Millisecond
+	retryMaxDelay  = 60 * time.Second
+)
+
+// httpSettings configures the shared HTTP client
+type httpSettings struct {
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	MaxRetries     int
+	Verbose        bool
+
+	// RecordDir saves every upstream response; ReplayDir serves saved
+	// responses instead of making requests
+	RecordDir string
+	ReplayDir string
+}
+
+// httpClient is shared by every provider and geocoder so that all upstream
+// requests get the same timeouts, retries and per-host rate limiting
+var httpClient = newHTTPClient(httpSettings{
+	ConnectTimeout: defaultConnectTimeout,
+	ReadTimeout:    defaultReadTimeout,
+	MaxRetries:     defaultMaxRetries,
+})
+
+// defaultHostLimiter limits requests made through httpClient
+var defaultHostLimiter = newHostLimiter(0)
+
+// ConfigureHTTP rebuilds the shared client from the configuration. It must be
+// called before any requests are made.
+func ConfigureHTTP(config *Config) {
+	defaultHostLimiter.SetRate(config.RateLimit)
+	httpClient = newHTTPClient(httpSettings{
+		ConnectTimeout: config.ConnectTimeout,
+		ReadTimeout:    config.ReadTimeout,
+		MaxRetries:     config.MaxRetries,
+		Verbose:        config.Verbose,
+		RecordDir:      config.RecordDir,
+		ReplayDir:      config.ReplayDir,
+	})
+}
+
+// newHTTPClient builds a client that retries failed requests, waiting for the
+// rate limiter before every attempt. In replay mode the client never touches
+// the network, so there is nothing to retry or rate limit.
+func newHTTPClient(settings httpSettings) *http.Client {
+	if settings.ReplayDir != "" {
+		return &http.Client{Transport: &replayTransport{dir: settings.ReplayDir}}
+	}
+
+	dialer := &net.Dialer{Timeout: settings.ConnectTimeout}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.TLSHandshakeTimeout = settings.ConnectTimeout
+
+	// Record each response as it comes off the network
+	var base http.RoundTripper = transport
+	if settings.RecordDir != "" {
+		base = &recordingTransport{base: transport, dir: settings.RecordDir}
+	}
+
+	return &http.Client{
+		Transport: &retryTransport{
+			base: &rateLimitedTransport{
+				base:    base,
+				limiter: defaultHostLimiter,
+			},
+			timeout:    settings.ReadTimeout,
+			maxRetries: settings.MaxRetries,
+			verbose:    settings.Verbose,
+		},
+	}
+}
+
+// retryTransport is an http.RoundTripper that bounds each attempt with a
+// timeout and retries idempotent requests on network errors, 429 and 5xx
+// responses with exponential backoff and jitter
+type retryTransport struct {
+	base       http.RoundTripper
+	timeout    time.Duration
+	maxRetries int
+	verbose    bool
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Never log query strings, which may contain API keys
+	target := req.URL.Host + req.URL.Path
+	retryable := req.Method == http.MethodGet || req.Method == http.MethodHead
+
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := req.Context(), context.CancelFunc(func() {})
+		if t.timeout > 0 {
+			ctx, cancel = context.WithTimeout(req.Context(), t.timeout)
+		}
+
+		start := time.Now()
+		resp, err := t.base.RoundTrip(req.Clone(ctx))
+
+		if t.verbose {
+			if err != nil {
+				log.Printf("%s %s: attempt %d failed after %v: %v", req.Method, target, attempt+1, time.Since(start).Round(time.Millisecond), err)
+			} else {
+				log.Printf("%s %s: attempt %d returned %d in %v", req.Method, target, attempt+1, resp.StatusCode, time.Since(start).Round(time.Millisecond))
+			}
+		}
+
+		if !retryable || attempt >= t.maxRetries || !shouldRetry(resp, err) || req.Context().Err() != nil {
+			if resp == nil {
+				cancel()
+				return nil, err
+			}
+			// Keep the attempt's timeout running while the body is read
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			return resp, err
+		}
+
+		delay := backoffDelay(attempt)
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+				delay = retryAfter
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) //nolint
+			resp.Body.Close()
+		}
+		cancel()
+
+		if delay > retryMaxDelay {
+			delay = retryMaxDelay
+		}
+		if t.verbose {
+			log.Printf("%s %s: retrying in %v", req.Method, target, delay.Round(time.Millisecond))
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// shouldRetry reports whether a failed attempt is worth retrying
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoffDelay returns the exponential backoff for an attempt with "equal
+// jitter": half the delay is fixed and the other half random
+func backoffDelay(attempt int) time.Duration {
+	delay := retryBaseDelay << attempt
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP
+// date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// cancelOnClose releases an attempt's context once the body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// hostLimiter spaces out requests to the same host
+type hostLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     map[string]time.Time
+}
+
+// newHostLimiter returns a limiter allowing rate requests per second to each
+// host. A rate of zero or less disables limiting.
+func newHostLimiter(rate float64) *hostLimiter {
+	limiter := &hostLimiter{next: map[string]time.Time{}}
+	limiter.SetRate(rate)
+	return limiter
+}
+
+// SetRate changes the number of requests per second allowed for each host
+func (l *hostLimiter) SetRate(rate float64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.interval = 0
+	if rate > 0 {
+		l.interval = time.Duration(float64(time.Second) / rate)
+	}
+}
+
+// reserve claims the next request slot for a host and returns how long the
+// caller must wait before using it
+func (l *hostLimiter) reserve(host string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.interval <= 0 {
+		return 0
+	}
+
+	slot := l.next[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next[host] = slot.Add(l.interval)
+	return slot.Sub(now)
+}
+
+// Wait blocks until a request to host is allowed or the context is cancelled
+func (l *hostLimiter) Wait(ctx context.Context, host string) error {
+	delay := l.reserve(host, time.Now())
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// rateLimitedTransport is an http.RoundTripper that waits for the host
+// limiter before sending each request
+type rateLimitedTransport struct {
+	base    http.RoundTripper
+	limiter *hostLimiter
+}
+
+func (t *rateLimitedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.limiter.Wait(req.Context(), req.URL.Host); err != nil {
+		return nil, err
+	}
+	return t.base.RoundTrip(req)
+}
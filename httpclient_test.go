@@ -0,0 +1,149 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHostLimiter(t *testing.T) {
+	limiter := newHostLimiter(2)
+	now := time.Now()
+
+	// Requests to the same host are spaced by the interval
+	delays := []time.Duration{
+		limiter.reserve("api.weather.gov", now),
+		limiter.reserve("api.weather.gov", now),
+		limiter.reserve("api.weather.gov", now),
+	}
+	expected := []time.Duration{0, 500 * time.Millisecond, time.Second}
+	for i := range delays {
+		if delays[i] != expected[i] {
+			t.Errorf("Expected delay %v for request %d, got %v", expected[i], i, delays[i])
+		}
+	}
+
+	// Other hosts are limited independently
+	if delay := limiter.reserve("api.open-meteo.com", now); delay != 0 {
+		t.Errorf("Expected no delay for a different host, got %v", delay)
+	}
+
+	// A rate of zero disables limiting
+	limiter.SetRate(0)
+	if delay := limiter.reserve("api.weather.gov", now); delay != 0 {
+		t.Errorf("Expected no delay without a rate limit, got %v", delay)
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&attempts, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Write([]byte("ok")) //nolint
+		}
+	}))
+	defer server.Close()
+
+	client := newHTTPClient(httpSettings{ConnectTimeout: time.Second, ReadTimeout: time.Second, MaxRetries: 3})
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "ok" {
+		t.Errorf("Expected 200 ok, got %d %q", resp.StatusCode, body)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestRetryTransportGivesUp(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := newHTTPClient(httpSettings{ConnectTimeout: time.Second, ReadTimeout: time.Second, MaxRetries: 2})
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	resp.Body.Close()
+
+	// The last response is returned once retries are exhausted
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected status 502, got %d", resp.StatusCode)
+	}
+	if attempts != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts)
+	}
+}
+
+func TestRetryTransportTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	client := newHTTPClient(httpSettings{ConnectTimeout: time.Second, ReadTimeout: 50 * time.Millisecond})
+	start := time.Now()
+	if _, err := client.Get(server.URL); err == nil {
+		t.Fatal("Expected a timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the request to time out quickly, took %v", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"", 0, false},
+		{"120", 2 * time.Minute, true},
+		{"Mon, 01 Jan 2024 12:00:30 GMT", 30 * time.Second, true},
+		{"Mon, 01 Jan 2024 11:00:00 GMT", 0, true},
+		{"soon", 0, false},
+	}
+
+	for _, test := range tests {
+		delay, ok := parseRetryAfter(test.value, now)
+		if delay != test.expected || ok != test.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; expected %v, %v", test.value, delay, ok, test.expected, test.ok)
+		}
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	for attempt := 0; attempt < 10; attempt++ {
+		full := retryBaseDelay << attempt
+		if full > retryMaxDelay {
+			full = retryMaxDelay
+		}
+		delay := backoffDelay(attempt)
+		if delay < full/2 || delay > full {
+			t.Errorf("Attempt %d: expected delay between %v and %v, got %v", attempt, full/2, full, delay)
+		}
+	}
+}
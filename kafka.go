@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+const (
+	// Default producer batching: how long to wait for more records before
+	// sending a batch, and the largest batch sent to a partition
+	defaultKafkaLinger     = 10 * time.Millisecond
+	defaultKafkaBatchBytes = 1000000
+
+	// Time allowed to deliver a record, including retries
+	kafkaDeliveryTimeout = 30 * time.Second
+)
+
+// kafkaClient is the part of *kgo.Client the producer uses
+type kafkaClient interface {
+	Produce(ctx context.Context, record *kgo.Record, promise func(*kgo.Record, error))
+	Flush(ctx context.Context) error
+	Close()
+}
+
+// KafkaProducer sends weather records and alert events to Kafka. Records are
+// keyed by location ID, so each location's records stay in order on one
+// partition.
+type KafkaProducer struct {
+	client      kafkaClient
+	alertsTopic string
+
+	// failed counts the records that weren't delivered since the last flush
+	failed atomic.Int64
+}
+
+// kafkaProducer is the producer shared by the Kafka sinks, set by
+// ConfigureKafka
+var kafkaProducer *KafkaProducer
+
+// ConfigureKafka creates the Kafka producer if any output needs one, closing
+// the previous producer. It must only be called between runs.
+func ConfigureKafka(config *Config) error {
+	specs, err := config.SinkSpecs()
+	if err != nil {
+		return err
+	}
+
+	var producer *KafkaProducer
+	if hasKafkaSink(specs) {
+		producer, err = NewKafkaProducer(config)
+		if err != nil {
+			return err
+		}
+	}
+
+	CloseKafka()
+	kafkaProducer = producer
+	return nil
+}
+
+// CloseKafka flushes and closes the Kafka producer, if there is one
+func CloseKafka() {
+	if kafkaProducer == nil {
+		return
+	}
+	if err := kafkaProducer.Flush(context.Background()); err != nil {
+		log.Printf("Error flushing Kafka producer: %v", err)
+	}
+	kafkaProducer.Close()
+	kafkaProducer = nil
+}
+
+// NewKafkaProducer creates a producer for the configured brokers. Brokers are
+// only contacted once the first record is sent.
+func NewKafkaProducer(config *Config) (*KafkaProducer, error) {
+	opts, err := kafkaOptions(config)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating Kafka producer: %w", err)
+	}
+	return &KafkaProducer{
+		client:      client,
+		alertsTopic: config.KafkaAlertsTopic,
+	}, nil
+}
+
+// kafkaOptions translates the configuration into producer options
+func kafkaOptions(config *Config) ([]kgo.Opt, error) {
+	var brokers []string
+	for _, broker := range strings.Split(config.KafkaBroker, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	if len(brokers) == 0 {
+		return nil, fmt.Errorf("kafka broker is required when using kafka output format")
+	}
+
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(brokers...),
+		kgo.ProducerLinger(config.KafkaLinger),
+		kgo.RecordDeliveryTimeout(kafkaDeliveryTimeout),
+	}
+	if config.KafkaBatchBytes > 0 {
+		opts = append(opts, kgo.ProducerBatchMaxBytes(int32(config.KafkaBatchBytes)))
+	}
+
+	// Idempotent writes need acknowledgement from all in-sync replicas
+	switch config.KafkaAcks {
+	case "all", "":
+		opts = append(opts, kgo.RequiredAcks(kgo.AllISRAcks()))
+	case "leader":
+		opts = append(opts, kgo.RequiredAcks(kgo.LeaderAck()), kgo.DisableIdempotentWrite())
+	case "none":
+		opts = append(opts, kgo.RequiredAcks(kgo.NoAck()), kgo.DisableIdempotentWrite())
+	default:
+		return nil, fmt.Errorf("invalid Kafka acks: %s (use all, leader or none)", config.KafkaAcks)
+	}
+
+	switch config.KafkaCompression {
+	case "none":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.NoCompression()))
+	case "gzip":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.GzipCompression()))
+	case "snappy", "":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.SnappyCompression()))
+	case "lz4":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.Lz4Compression()))
+	case "zstd":
+		opts = append(opts, kgo.ProducerBatchCompression(kgo.ZstdCompression()))
+	default:
+		return nil, fmt.Errorf("invalid Kafka compression: %s (use none, gzip, snappy, lz4 or zstd)", config.KafkaCompression)
+	}
+
+	if config.KafkaTLS {
+		tlsConfig, err := kafkaTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, kgo.DialTLSConfig(tlsConfig))
+	}
+
+	if config.KafkaSASLMechanism != "" {
+		if config.KafkaSASLUsername == "" {
+			return nil, fmt.Errorf("-kafka-sasl-username is required with -kafka-sasl-mechanism")
+		}
+		switch config.KafkaSASLMechanism {
+		case "plain":
+			opts = append(opts, kgo.SASL(plain.Auth{User: config.KafkaSASLUsername, Pass: config.KafkaSASLPassword}.AsMechanism()))
+		case "scram-sha-256":
+			opts = append(opts, kgo.SASL(scram.Auth{User: config.KafkaSASLUsername, Pass: config.KafkaSASLPassword}.AsSha256Mechanism()))
+		case "scram-sha-512":
+			opts = append(opts, kgo.SASL(scram.Auth{User: config.KafkaSASLUsername, Pass: config.KafkaSASLPassword}.AsSha512Mechanism()))
+		default:
+			return nil, fmt.Errorf("invalid Kafka SASL mechanism: %s (use plain, scram-sha-256 or scram-sha-512)", config.KafkaSASLMechanism)
+		}
+	}
+
+	return opts, nil
+}
+
+// kafkaTLSConfig builds the TLS configuration for broker connections,
+// trusting the system roots unless a CA file is given
+func kafkaTLSConfig(config *Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if config.KafkaTLSCA != "" {
+		pem, err := os.ReadFile(config.KafkaTLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("error reading Kafka CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in Kafka CA file %s", config.KafkaTLSCA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	// A client certificate is optional, but needs both halves
+	if (config.KafkaTLSCert == "") != (config.KafkaTLSKey == "") {
+		return nil, fmt.Errorf("-kafka-tls-cert and -kafka-tls-key must be used together")
+	}
+	if config.KafkaTLSCert != "" {
+		cert, err := tls.LoadX509KeyPair(config.KafkaTLSCert, config.KafkaTLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("error loading Kafka client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// Send queues a weather record for delivery to a topic, and an event for each
+// of its alerts to the alerts topic. Records are batched; delivery errors are
+// logged and reported by Flush.
+func (p *KafkaProducer) Send(ctx context.Context, topic string, data WeatherData) error {
+	value, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error encoding weather data: %w", err)
+	}
+	p.produce(ctx, topic, data.LocationID, value, data.Timestamp)
+
+	for _, event := range alertEvents(data) {
+		value, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("error encoding alert: %w", err)
+		}
+		p.produce(ctx, p.alertsTopic, event.LocationID, value, event.Timestamp)
+	}
+	return nil
+}
+
+// produce queues a single JSON record
+func (p *KafkaProducer) produce(ctx context.Context, topic, key string, value []byte, timestamp time.Time) {
+	record := &kgo.Record{
+		Topic:     topic,
+		Key:       []byte(key),
+		Value:     value,
+		Timestamp: timestamp,
+		Headers:   []kgo.RecordHeader{{Key: "content-type", Value: []byte("application/json")}},
+	}
+	p.client.Produce(ctx, record, func(record *kgo.Record, err error) {
+		if err != nil {
+			log.Printf("Error sending %s to Kafka topic %s: %v", key, record.Topic, err)
+			p.failed.Add(1)
+		}
+	})
+}
+
+// Flush waits until every queued record has been delivered or has failed,
+// and returns an error if any record since the last flush failed
+func (p *KafkaProducer) Flush(ctx context.Context) error {
+	err := p.client.Flush(ctx)
+	failed := p.failed.Swap(0)
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d Kafka records weren't delivered", failed)
+	}
+	return nil
+}
+
+// Close closes the producer, failing records that weren't flushed
+func (p *KafkaProducer) Close() {
+	p.client.Close()
+}
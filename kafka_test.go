@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+// fakeKafkaClient records produced records instead of sending them. Like
+// *kgo.Client, it fails records and flushes whose context is done.
+type fakeKafkaClient struct {
+	// fail is the delivery error of every record, if set
+	fail error
+
+	records []*kgo.Record
+	flushed bool
+	closed  bool
+}
+
+func (c *fakeKafkaClient) Produce(ctx context.Context, record *kgo.Record, promise func(*kgo.Record, error)) {
+	if err := ctx.Err(); err != nil {
+		promise(record, err)
+		return
+	}
+	c.records = append(c.records, record)
+	promise(record, c.fail)
+}
+
+func (c *fakeKafkaClient) Flush(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.flushed = true
+	return nil
+}
+
+func (c *fakeKafkaClient) Close() {
+	c.closed = true
+}
+
+func TestKafkaProducerSend(t *testing.T) {
+	client := &fakeKafkaClient{}
+	producer := &KafkaProducer{client: client, alertsTopic: "weather-alerts"}
+
+	data := WeatherData{
+		LocationID:   "zip:80202",
+		LocationName: "Denver",
+		Timestamp:    time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+		Source:       "nws",
+		Temperature:  ptr(25.0),
+		Alerts: []WeatherAlert{
+			{Event: "Tornado Warning", Severity: "Extreme"},
+			{Event: "Heat Advisory", Severity: "Moderate"},
+		},
+	}
+	if err := producer.Send(context.Background(), "weather-data", data); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if len(client.records) != 3 {
+		t.Fatalf("Expected a weather record and 2 alert events, got %d records", len(client.records))
+	}
+	for i, record := range client.records {
+		if string(record.Key) != "zip:80202" {
+			t.Errorf("Expected record %d to be keyed by location ID, got %q", i, record.Key)
+		}
+		if !record.Timestamp.Equal(data.Timestamp) {
+			t.Errorf("Expected record %d to have the observation time, got %v", i, record.Timestamp)
+		}
+	}
+
+	weather := client.records[0]
+	if weather.Topic != "weather-data" {
+		t.Errorf("Expected weather record on weather-data, got %s", weather.Topic)
+	}
+	var decoded WeatherData
+	if err := json.Unmarshal(weather.Value, &decoded); err != nil {
+		t.Fatalf("Expected weather record to be JSON, got: %v", err)
+	}
+	if decoded.Temperature == nil || *decoded.Temperature != 25 {
+		t.Errorf("Expected temperature 25, got %v", decoded.Temperature)
+	}
+
+	for i, expected := range []string{"Tornado Warning", "Heat Advisory"} {
+		record := client.records[i+1]
+		if record.Topic != "weather-alerts" {
+			t.Errorf("Expected alert event on weather-alerts, got %s", record.Topic)
+		}
+		var event AlertEvent
+		if err := json.Unmarshal(record.Value, &event); err != nil {
+			t.Fatalf("Expected alert event to be JSON, got: %v", err)
+		}
+		if event.Event != expected || event.LocationName != "Denver" {
+			t.Errorf("Expected %s for Denver, got %s for %s", expected, event.Event, event.LocationName)
+		}
+	}
+
+	if err := producer.Flush(context.Background()); err != nil || !client.flushed {
+		t.Errorf("Expected producer to flush its client, got: %v", err)
+	}
+	producer.Close()
+	if !client.closed {
+		t.Error("Expected producer to close its client")
+	}
+}
+
+func TestKafkaProducerFakeBroker(t *testing.T) {
+	cluster, err := kfake.NewCluster(kfake.NumBrokers(1), kfake.SeedTopics(1, "weather-data", "weather-alerts"))
+	if err != nil {
+		t.Fatalf("Expected a fake cluster, got: %v", err)
+	}
+	defer cluster.Close()
+	brokers := strings.Join(cluster.ListenAddrs(), ",")
+
+	producer, err := NewKafkaProducer(&Config{KafkaBroker: brokers, KafkaAlertsTopic: "weather-alerts", KafkaCompression: "snappy"})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer producer.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, data := range []WeatherData{
+		{LocationID: "zip:80202", Timestamp: time.Now(), Alerts: []WeatherAlert{{Event: "Wind Advisory", Severity: "Moderate"}}},
+		{LocationID: "zip:10001", Timestamp: time.Now()},
+	} {
+		if err := producer.Send(ctx, "weather-data", data); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+	if err := producer.Flush(ctx); err != nil {
+		t.Fatalf("Expected the records to be delivered, got: %v", err)
+	}
+
+	// Read the records back from the start of both topics
+	consumer, err := kgo.NewClient(
+		kgo.SeedBrokers(cluster.ListenAddrs()...),
+		kgo.ConsumeTopics("weather-data", "weather-alerts"),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer consumer.Close()
+
+	var received []string
+	for len(received) < 3 {
+		fetches := consumer.PollFetches(ctx)
+		if err := ctx.Err(); err != nil {
+			t.Fatalf("Expected 3 records, got %v", received)
+		}
+		fetches.EachRecord(func(record *kgo.Record) {
+			received = append(received, record.Topic+" "+string(record.Key))
+			if len(record.Headers) != 1 || string(record.Headers[0].Value) != "application/json" {
+				t.Errorf("Expected a JSON content type header, got %v", record.Headers)
+			}
+		})
+	}
+
+	sort.Strings(received)
+	expected := []string{"weather-alerts zip:80202", "weather-data zip:10001", "weather-data zip:80202"}
+	if strings.Join(received, ", ") != strings.Join(expected, ", ") {
+		t.Errorf("Expected records %v, got %v", expected, received)
+	}
+}
+
+func TestKafkaSinkCancelledRun(t *testing.T) {
+	client := &fakeKafkaClient{}
+	defer func(producer *KafkaProducer) { kafkaProducer = producer }(kafkaProducer)
+	kafkaProducer = &KafkaProducer{client: client, alertsTopic: "weather-alerts"}
+
+	sink, _ := newKafkaSink("weather-data", &Config{})
+	if err := sink.Open(context.Background(), RunInfo{}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Results fetched before the run was cancelled are still delivered
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := sink.Write(ctx, WeatherData{LocationID: "zip:80202"}); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+	if err := sink.Flush(ctx); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+	if len(client.records) != 1 || !client.flushed {
+		t.Errorf("Expected the record to be sent and flushed, got %d records", len(client.records))
+	}
+}
+
+func TestKafkaSinkDeliveryFailures(t *testing.T) {
+	client := &fakeKafkaClient{fail: errors.New("broker unavailable")}
+	defer func(producer *KafkaProducer) { kafkaProducer = producer }(kafkaProducer)
+	kafkaProducer = &KafkaProducer{client: client, alertsTopic: "weather-alerts"}
+
+	sink, _ := newKafkaSink("weather-data", &Config{})
+	data := WeatherData{LocationID: "zip:80202", Alerts: []WeatherAlert{{Event: "Wind Advisory"}}}
+	if err := sink.Write(context.Background(), data); err != nil {
+		t.Fatalf("Expected no error queueing the record, got: %v", err)
+	}
+	if err := sink.Flush(context.Background()); err == nil || !strings.Contains(err.Error(), "2 Kafka records") {
+		t.Errorf("Expected the flush to report 2 undelivered records, got %v", err)
+	}
+
+	// The count starts over with the next run
+	client.fail = nil
+	if err := sink.Write(context.Background(), WeatherData{LocationID: "zip:10001"}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if err := sink.Flush(context.Background()); err != nil {
+		t.Errorf("Expected no error once records are delivered, got: %v", err)
+	}
+}
+
+func TestKafkaOptions(t *testing.T) {
+	valid := func() *Config {
+		return &Config{KafkaBroker: "kafka-1:9092, kafka-2:9092", KafkaAcks: "all", KafkaCompression: "snappy"}
+	}
+	if _, err := kafkaOptions(valid()); err != nil {
+		t.Errorf("Expected valid configuration, got: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Config)
+	}{
+		{"no brokers", func(c *Config) { c.KafkaBroker = " , " }},
+		{"unknown acks", func(c *Config) { c.KafkaAcks = "some" }},
+		{"unknown compression", func(c *Config) { c.KafkaCompression = "brotli" }},
+		{"unknown SASL mechanism", func(c *Config) { c.KafkaSASLMechanism = "gssapi"; c.KafkaSASLUsername = "weather" }},
+		{"SASL without username", func(c *Config) { c.KafkaSASLMechanism = "plain" }},
+		{"TLS cert without key", func(c *Config) { c.KafkaTLS = true; c.KafkaTLSCert = "client.pem" }},
+		{"missing CA file", func(c *Config) { c.KafkaTLS = true; c.KafkaTLSCA = "testdata/missing-ca.pem" }},
+	}
+	for _, test := range tests {
+		config := valid()
+		test.modify(config)
+		if _, err := kafkaOptions(config); err == nil {
+			t.Errorf("Expected %s to be rejected", test.name)
+		}
+	}
+}
+
+func TestKafkaSASLPasswordFromEnv(t *testing.T) {
+	t.Setenv("KAFKA_SASL_PASSWORD", "hunter2")
+
+	config, err := parseConfigArgs(nil, &bytes.Buffer{})
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if config.KafkaSASLPassword != "hunter2" {
+		t.Errorf("Expected the password from the environment, got %q", config.KafkaSASLPassword)
+	}
+
+	config, _ = parseConfigArgs([]string{"-kafka-sasl-password", "swordfish"}, &bytes.Buffer{})
+	if config.KafkaSASLPassword != "swordfish" {
+		t.Errorf("Expected the flag to override the environment, got %q", config.KafkaSASLPassword)
+	}
+
+	// The usage message must not show the password as the default
+	var usage bytes.Buffer
+	parseConfigArgs([]string{"-h"}, &usage) //nolint
+	if !strings.Contains(usage.String(), "-kafka-sasl-password") || strings.Contains(usage.String(), "hunter2") {
+		t.Errorf("Expected the usage message to list the flag without the password, got:\n%s", usage.String())
+	}
+}
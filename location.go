@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LocationKind identifies how a location was specified
+type LocationKind string
+
+const (
+	LocationZip     LocationKind = "zip"
+	LocationCoords  LocationKind = "coords"
+	LocationCity    LocationKind = "city"
+	LocationStation LocationKind = "icao"
+)
+
+// Location is a place to collect weather for, parsed from user input
+type Location struct {
+	Kind LocationKind
+
+	// ZIP is the five-digit ZIP code and ZIP4 the optional add-on code
+	ZIP  string
+	ZIP4 string
+
+	// Lat and Lon are set for coordinate locations
+	Lat float64
+	Lon float64
+
+	// City is the city name and Region the optional state or country
+	City   string
+	Region string
+
+	// Station is the ICAO station identifier
+	Station string
+}
+
+// ParseLocation parses a location in one of the forms "zip:90210",
+// "zip:90210-1234", "39.74,-104.99", "city:Denver,CO" or "icao:KDEN". A bare
+// five-digit or ZIP+4 code is treated as a ZIP code.
+func ParseLocation(input string) (Location, error) {
+	input = strings.TrimSpace(input)
+	prefix, value, hasPrefix := strings.Cut(input, ":")
+	if !hasPrefix {
+		if isValidZip(input) || isValidZip4(input) {
+			return parseZipLocation(input)
+		}
+		return parseCoordsLocation(input)
+	}
+
+	value = strings.TrimSpace(value)
+	switch LocationKind(strings.ToLower(prefix)) {
+	case LocationZip:
+		return parseZipLocation(value)
+	case LocationCoords:
+		return parseCoordsLocation(value)
+	case LocationCity:
+		city, region, _ := strings.Cut(value, ",")
+		city = strings.TrimSpace(city)
+		if city == "" {
+			return Location{}, fmt.Errorf("invalid city location: %s", input)
+		}
+		return Location{Kind: LocationCity, City: city, Region: strings.TrimSpace(region)}, nil
+	case LocationStation:
+		station := strings.ToUpper(value)
+		if len(station) != 4 || !isAlphanumeric(station) {
+			return Location{}, fmt.Errorf("invalid ICAO station identifier: %s", value)
+		}
+		return Location{Kind: LocationStation, Station: station}, nil
+	default:
+		return Location{}, fmt.Errorf("unknown location type %q in %s (expected zip, coords, city or icao)", prefix, input)
+	}
+}
+
+// parseZipLocation parses a five-digit ZIP code or ZIP+4 code
+func parseZipLocation(value string) (Location, error) {
+	if isValidZip(value) {
+		return Location{Kind: LocationZip, ZIP: value}, nil
+	}
+	if isValidZip4(value) {
+		return Location{Kind: LocationZip, ZIP: value[:5], ZIP4: value[6:]}, nil
+	}
+	return Location{}, fmt.Errorf("invalid ZIP code format: %s", value)
+}
+
+// parseCoordsLocation parses a "lat,lon" pair
+func parseCoordsLocation(value string) (Location, error) {
+	latStr, lonStr, ok := strings.Cut(value, ",")
+	if !ok {
+		return Location{}, fmt.Errorf("invalid location: %s", value)
+	}
+
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return Location{}, fmt.Errorf("invalid latitude in %s", value)
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return Location{}, fmt.Errorf("invalid longitude in %s", value)
+	}
+
+	return Location{Kind: LocationCoords, Lat: lat, Lon: lon}, nil
+}
+
+// ID returns a stable identifier for the location. ZIP codes are returned as
+// is so that existing records keep their IDs; other kinds are prefixed.
+func (l Location) ID() string {
+	switch l.Kind {
+	case LocationZip:
+		if l.ZIP4 != "" {
+			return l.ZIP + "-" + l.ZIP4
+		}
+		return l.ZIP
+	case LocationCoords:
+		return fmt.Sprintf("coords:%.4f,%.4f", l.Lat, l.Lon)
+	case LocationCity:
+		id := "city:" + strings.ToLower(l.City)
+		if l.Region != "" {
+			id += "," + strings.ToLower(l.Region)
+		}
+		return strings.ReplaceAll(id, " ", "-")
+	case LocationStation:
+		return "icao:" + l.Station
+	default:
+		return ""
+	}
+}
+
+// Label returns a short human-readable description of how the location was
+// specified, used in text output
+func (l Location) Label() string {
+	switch l.Kind {
+	case LocationZip:
+		return "ZIP: " + l.ID()
+	case LocationCoords:
+		return fmt.Sprintf("%.4f, %.4f", l.Lat, l.Lon)
+	case LocationStation:
+		return "ICAO: " + l.Station
+	case LocationCity:
+		if l.Region != "" {
+			return l.City + ", " + l.Region
+		}
+		return l.City
+	default:
+		return l.ID()
+	}
+}
+
+func (l Location) String() string {
+	return l.ID()
+}
+
+// locationLabel returns the text output label for a location ID
+func locationLabel(id string) string {
+	if isValidZip(id) || isValidZip4(id) {
+		return "ZIP: " + id
+	}
+	return id
+}
+
+// isValidZip4 reports whether a string is a ZIP+4 code such as 90210-1234
+func isValidZip4(zip string) bool {
+	return len(zip) == 10 && zip[5] == '-' && isValidZip(zip[:5]) && isDigits(zip[6:])
+}
+
+// isDigits reports whether a string contains only ASCII digits
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// isAlphanumeric reports whether a string contains only ASCII letters and digits
+func isAlphanumeric(s string) bool {
+	for _, r := range s {
+		if !(r >= '0' && r <= '9' || r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseLocation(t *testing.T) {
+	tests := []struct {
+		input string
+		kind  LocationKind
+		id    string
+	}{
+		{"90210", LocationZip, "90210"},
+		{"zip:90210", LocationZip, "90210"},
+		{"zip:90210-1234", LocationZip, "90210-1234"},
+		{"39.7392,-104.9903", LocationCoords, "coords:39.7392,-104.9903"},
+		{"coords:-33.9, 18.4", LocationCoords, "coords:-33.9000,18.4000"},
+		{"city:Denver,CO", LocationCity, "city:denver,co"},
+		{"city:New York", LocationCity, "city:new-york"},
+		{"icao:kden", LocationStation, "icao:KDEN"},
+	}
+
+	for _, test := range tests {
+		loc, err := ParseLocation(test.input)
+		if err != nil {
+			t.Errorf("Expected no error for %q, got: %v", test.input, err)
+			continue
+		}
+		if loc.Kind != test.kind {
+			t.Errorf("Expected kind %s for %q, got %s", test.kind, test.input, loc.Kind)
+		}
+		if loc.ID() != test.id {
+			t.Errorf("Expected ID %s for %q, got %s", test.id, test.input, loc.ID())
+		}
+	}
+
+	invalid := []string{"9021", "zip:abcde", "91.0,0", "0,181", "city:", "icao:DEN", "airport:KDEN", "Denver"}
+	for _, input := range invalid {
+		if _, err := ParseLocation(input); err == nil {
+			t.Errorf("Expected error for %q, got nil", input)
+		}
+	}
+}
+
+func TestFetchOpenMeteoCityCoordinates(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"results": [
+			{"name": "Paris", "latitude": 48.8534, "longitude": 2.3488, "country_code": "FR", "country": "France", "admin1": "Île-de-France"},
+			{"name": "Paris", "latitude": 33.6609, "longitude": -95.5555, "country_code": "US", "country": "United States", "admin1": "Texas"}
+		]}`)) //nolint
+	}))
+	defer server.Close()
+
+	lat, _, name, err := fetchOpenMeteoCityCoordinates(context.Background(), server.URL, "Paris", "")
+	if err != nil || name != "Paris" || lat != 48.8534 {
+		t.Errorf("Expected the first result without a region, got %v, %s (%v)", lat, name, err)
+	}
+
+	// US state codes match the admin1 name
+	lat, _, _, err = fetchOpenMeteoCityCoordinates(context.Background(), server.URL, "Paris", "TX")
+	if err != nil || lat != 33.6609 {
+		t.Errorf("Expected Paris, TX, got %v (%v)", lat, err)
+	}
+
+	if _, _, _, err := fetchOpenMeteoCityCoordinates(context.Background(), server.URL, "Paris", "ON"); err == nil {
+		t.Error("Expected error for unmatched region, got nil")
+	}
+}
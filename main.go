@@ -2,35 +2,35 @@ package main
 
 import (
 	"log"
-	"time"
+	"os"
 )
 
 func main() {
 	// Parse command line flags
 	config := ParseFlags()
 
+	// Handle the cache subcommand
+	if len(config.Args) > 0 && config.Args[0] == "cache" {
+		if err := RunCacheCommand(config, config.Args[1:]); err != nil {
+			log.Fatalf("Cache error: %v", err)
+		}
+		return
+	}
+
 	// Validate config
 	if err := ValidateConfig(config); err != nil {
 		log.Fatalf("Configuration error: %v", err)
 	}
 
-	// Process locations (either once or on interval)
-	if config.Interval > 0 {
-		// Run continuously with interval
-		ticker := time.NewTicker(config.Interval)
-		defer ticker.Stop()
-
-		log.Printf("Starting weather data pipeline. Fetching data every %v", config.Interval)
-
-		// Run once immediately
-		ProcessLocations(config)
-
-		// Then on ticker interval
-		for range ticker.C {
-			ProcessLocations(config)
-		}
-	} else {
-		// Run once
-		ProcessLocations(config)
+	// Apply upstream request and output settings
+	ConfigureHTTP(config)
+	ConfigureEndpoints(config)
+	if err := ConfigureKafka(config); err != nil {
+		log.Fatalf("Configuration error: %v", err)
 	}
+
+	// Process locations (either once or on interval) until a signal stops us
+	code := Run(config, os.Args[1:])
+	CloseOutputs()
+	os.Exit(code)
 }
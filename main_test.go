@@ -1,6 +1,12 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 )
 
@@ -65,3 +71,111 @@ func TestIsValidZip(t *testing.T) {
 		}
 	}
 }
+
+func TestLookupZipCoordinates(t *testing.T) {
+	lat, lon, city, err := lookupZipCoordinates("60601")
+	if err != nil {
+		t.Fatalf("Expected no error for known ZIP code, got: %v", err)
+	}
+	if city != "Chicago" || lat == 0 || lon == 0 {
+		t.Errorf("Unexpected result for 60601: %v, %v, %s", lat, lon, city)
+	}
+
+	// Unknown ZIP codes are an error rather than a default location
+	if _, _, _, err := lookupZipCoordinates("00000"); err == nil {
+		t.Error("Expected error for unknown ZIP code, got nil")
+	}
+}
+
+func TestGeocodeZipSearch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("name") != "99999" || r.URL.Query().Get("countryCode") != "US" {
+			w.Write([]byte(`{}`)) //nolint
+			return
+		}
+		w.Write([]byte(`{"results": [
+			{"name": "Ketchikan", "latitude": 55.3422, "longitude": -131.6461, "country_code": "US", "country": "United States", "admin1": "Alaska"}
+		]}`)) //nolint
+	}))
+	defer server.Close()
+
+	defer func(e Endpoints, p URLPolicy) { endpoints, urlPolicy = e, p }(endpoints, urlPolicy)
+	ConfigureEndpoints(&Config{OpenMeteoGeocodingBaseURL: server.URL, AllowedHosts: []string{"127.0.0.1"}, AllowHTTP: true})
+
+	zip := Location{Kind: LocationZip, ZIP: "99999"}
+
+	// ZIP codes missing from the gazetteer stay offline unless -zip-search
+	// is given
+	offline := &defaultGeocoder{}
+	if _, _, _, err := offline.Geocode(context.Background(), zip); !errors.Is(err, errUnknownZIP) {
+		t.Errorf("Expected an unknown ZIP code error without -zip-search, got %v", err)
+	}
+
+	search := &defaultGeocoder{zipSearch: true}
+	lat, _, city, err := search.Geocode(context.Background(), zip)
+	if err != nil || city != "Ketchikan" || lat != 55.3422 {
+		t.Errorf("Expected the Open-Meteo result, got %v, %s (%v)", lat, city, err)
+	}
+
+	if _, _, _, err := search.Geocode(context.Background(), Location{Kind: LocationZip, ZIP: "00000"}); !errors.Is(err, errUnknownZIP) {
+		t.Errorf("Expected an unknown ZIP code error, got %v", err)
+	}
+}
+
+func TestNWSValue(t *testing.T) {
+	var observation NWSObservationResponse
+	data := `{"properties": {
+		"temperature": {"unitCode": "wmoUnit:degC", "value": 0, "qualityControl": "V"},
+		"windSpeed": {"unitCode": "wmoUnit:km_h-1", "value": null, "qualityControl": "Z"},
+		"relativeHumidity": {"unitCode": "wmoUnit:percent", "value": 140, "qualityControl": "X"}
+	}}`
+	if err := json.Unmarshal([]byte(data), &observation); err != nil {
+		t.Fatalf("Expected observation to decode, got: %v", err)
+	}
+
+	// A genuine zero is a valid value
+	if value, ok := observation.Properties.Temperature.Get(); !ok || value != 0 {
+		t.Errorf("Expected a valid 0°C temperature, got %v, %v", value, ok)
+	}
+
+	// Null values and values that failed quality control are missing
+	if _, ok := observation.Properties.WindSpeed.Get(); ok {
+		t.Error("Expected null wind speed to be missing")
+	}
+	if _, ok := observation.Properties.RelativeHumidity.Get(); ok {
+		t.Error("Expected rejected humidity to be missing")
+	}
+	if _, ok := observation.Properties.HeatIndex.Get(); ok {
+		t.Error("Expected an absent heat index to be missing")
+	}
+}
+
+func TestConvertNWSHourly(t *testing.T) {
+	var forecast NWSForecastResponse
+	data := `{"properties": {"periods": [
+		{"startTime": "2024-06-01T12:00:00-06:00", "temperature": 77, "temperatureUnit": "F", "windSpeed": "10 mph",
+		 "shortForecast": "Sunny", "probabilityOfPrecipitation": {"unitCode": "wmoUnit:percent", "value": 20}},
+		{"startTime": "2024-06-01T13:00:00-06:00", "temperature": 26, "temperatureUnit": "C", "windSpeed": "5 to 15 km/h",
+		 "shortForecast": "Chance Showers", "probabilityOfPrecipitation": {"unitCode": "wmoUnit:percent", "value": null}}
+	]}}`
+	if err := json.Unmarshal([]byte(data), &forecast); err != nil {
+		t.Fatalf("Expected forecast to decode, got: %v", err)
+	}
+
+	hourly := convertNWSHourly(forecast)
+	if len(hourly) != 2 {
+		t.Fatalf("Expected 2 hours, got %d", len(hourly))
+	}
+	if math.Abs(*hourly[0].Temp-25) > 0.01 || math.Abs(*hourly[0].WindSpeed-4.47) > 0.01 || *hourly[0].Pop != 0.2 {
+		t.Errorf("Expected 25°C, 4.47 m/s and a 0.2 chance of rain, got %v, %v and %v", *hourly[0].Temp, *hourly[0].WindSpeed, *hourly[0].Pop)
+	}
+
+	// Wind ranges use the upper end, and a null probability is missing
+	if math.Abs(*hourly[1].WindSpeed-4.17) > 0.01 || hourly[1].Pop != nil {
+		t.Errorf("Expected 4.17 m/s and no probability, got %v and %v", *hourly[1].WindSpeed, hourly[1].Pop)
+	}
+
+	if parseNWSWindSpeed("calm") != nil {
+		t.Error("Expected an unparseable wind speed to be missing")
+	}
+}
@@ -0,0 +1,440 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	// Time zones are looked up by name, which needs the zone database even
+	// where the system has none, such as in minimal containers
+	_ "time/tzdata"
+
+	"github.com/bradfitz/latlong"
+)
+
+// MetNoResponse is the subset of the Locationforecast compact response we use
+type MetNoResponse struct {
+	Properties struct {
+		Timeseries []struct {
+			Time string `json:"time"`
+			Data struct {
+				Instant struct {
+					Details struct {
+						AirTemperature        *float64 `json:"air_temperature"`
+						AirPressureAtSeaLevel *float64 `json:"air_pressure_at_sea_level"`
+						RelativeHumidity      *float64 `json:"relative_humidity"`
+						WindSpeed             *float64 `json:"wind_speed"`
+					} `json:"details"`
+				} `json:"instant"`
+				Next1Hours  *metNoSummary `json:"next_1_hours"`
+				Next6Hours  *metNoSummary `json:"next_6_hours"`
+				Next12Hours *metNoSummary `json:"next_12_hours"`
+			} `json:"data"`
+		} `json:"timeseries"`
+	} `json:"properties"`
+}
+
+// metNoSummary is the symbol summary and precipitation of a forecast period,
+// and for six-hour periods the lowest and highest temperature
+type metNoSummary struct {
+	Summary struct {
+		SymbolCode string `json:"symbol_code"`
+	} `json:"summary"`
+	Details struct {
+		PrecipitationAmount *float64 `json:"precipitation_amount"`
+		AirTemperatureMin   *float64 `json:"air_temperature_min"`
+		AirTemperatureMax   *float64 `json:"air_temperature_max"`
+	} `json:"details"`
+}
+
+// metNoCacheEntry holds a response along with its caching headers
+type metNoCacheEntry struct {
+	data         MetNoResponse
+	lastModified string
+	expires      time.Time
+}
+
+// Expired responses are kept for revalidation for metNoCacheRetention, and
+// at most metNoCacheSize are kept in all
+const (
+	metNoCacheRetention = 6 * time.Hour
+	metNoCacheSize      = 1000
+)
+
+// metNoCache stores responses by URL. MET Norway's terms of service require
+// clients not to re-request data before it expires and to use conditional
+// requests afterwards.
+var metNoCache = struct {
+	sync.Mutex
+	entries map[string]*metNoCacheEntry
+}{entries: map[string]*metNoCacheEntry{}}
+
+// metNoSymbols maps MET Norway symbol codes (without the _day/_night/
+// _polartwilight variant) to descriptions. The "lights..." spellings match
+// the codes the API actually returns.
+var metNoSymbols = map[string]string{
+	"clearsky":                     "clear sky",
+	"fair":                         "fair",
+	"partlycloudy":                 "partly cloudy",
+	"cloudy":                       "cloudy",
+	"fog":                          "fog",
+	"lightrain":                    "light rain",
+	"rain":                         "rain",
+	"heavyrain":                    "heavy rain",
+	"lightrainshowers":             "light rain showers",
+	"rainshowers":                  "rain showers",
+	"heavyrainshowers":             "heavy rain showers",
+	"lightsleet":                   "light sleet",
+	"sleet":                        "sleet",
+	"heavysleet":                   "heavy sleet",
+	"lightsleetshowers":            "light sleet showers",
+	"sleetshowers":                 "sleet showers",
+	"heavysleetshowers":            "heavy sleet showers",
+	"lightsnow":                    "light snow",
+	"snow":                         "snow",
+	"heavysnow":                    "heavy snow",
+	"lightsnowshowers":             "light snow showers",
+	"snowshowers":                  "snow showers",
+	"heavysnowshowers":             "heavy snow showers",
+	"lightrainandthunder":          "light rain and thunder",
+	"rainandthunder":               "rain and thunder",
+	"heavyrainandthunder":          "heavy rain and thunder",
+	"lightrainshowersandthunder":   "light rain showers and thunder",
+	"rainshowersandthunder":        "rain showers and thunder",
+	"heavyrainshowersandthunder":   "heavy rain showers and thunder",
+	"lightsleetandthunder":         "light sleet and thunder",
+	"sleetandthunder":              "sleet and thunder",
+	"heavysleetandthunder":         "heavy sleet and thunder",
+	"lightsnowandthunder":          "light snow and thunder",
+	"snowandthunder":               "snow and thunder",
+	"heavysnowandthunder":          "heavy snow and thunder",
+	"lightssleetshowersandthunder": "light sleet showers and thunder",
+	"sleetshowersandthunder":       "sleet showers and thunder",
+	"heavysleetshowersandthunder":  "heavy sleet showers and thunder",
+	"lightssnowshowersandthunder":  "light snow showers and thunder",
+	"snowshowersandthunder":        "snow showers and thunder",
+	"heavysnowshowersandthunder":   "heavy snow showers and thunder",
+}
+
+// metNoDescription returns the description for a MET Norway symbol code
+func metNoDescription(symbol string) string {
+	base := symbol
+	if i := strings.Index(symbol, "_"); i >= 0 {
+		base = symbol[:i]
+	}
+	if description, ok := metNoSymbols[base]; ok {
+		return description
+	}
+	return base
+}
+
+func init() {
+	RegisterProvider("met-no", newMetNoProvider)
+}
+
+// metNoProvider fetches weather from the MET Norway Locationforecast API
+type metNoProvider struct{}
+
+func newMetNoProvider(config *Config) (WeatherProvider, error) {
+	return &metNoProvider{}, nil
+}
+
+func (p *metNoProvider) Name() string {
+	return "met-no"
+}
+
+func (p *metNoProvider) GetWeather(ctx context.Context, lat, lon float64) (WeatherResponse, error) {
+	return getMetNoWeather(ctx, lat, lon)
+}
+
+// getMetNoWeather fetches weather data from the MET Norway API
+func getMetNoWeather(ctx context.Context, lat, lon float64) (WeatherResponse, error) {
+	// MET Norway asks for at most four decimals to keep its cache effective
+	urlStr := fmt.Sprintf("%s%s?lat=%.4f&lon=%.4f", endpoints.MetNo, metNoEndpoint, lat, lon)
+
+	if err := validateURL(urlStr); err != nil {
+		return WeatherResponse{}, fmt.Errorf("URL validation failed: %w", err)
+	}
+
+	data, err := fetchMetNoForecast(ctx, urlStr, time.Now())
+	if err != nil {
+		return WeatherResponse{}, err
+	}
+
+	return convertMetNo(data, metNoZone(lat, lon))
+}
+
+// fetchMetNoForecast returns the forecast for a URL, serving it from the cache
+// until it expires and revalidating it with If-Modified-Since afterwards
+func fetchMetNoForecast(ctx context.Context, urlStr string, now time.Time) (MetNoResponse, error) {
+	metNoCache.Lock()
+	var entry metNoCacheEntry
+	stored, cached := metNoCache.entries[urlStr]
+	if cached {
+		entry = *stored
+	}
+	metNoCache.Unlock()
+
+	if cached && now.Before(entry.expires) {
+		return entry.data, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return MetNoResponse{}, fmt.Errorf("error creating request: %w", err)
+	}
+
+	// MET Norway rejects requests without an identifying User-Agent
+	req.Header.Set("User-Agent", userAgent)
+	if cached && entry.lastModified != "" {
+		req.Header.Set("If-Modified-Since", entry.lastModified)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return MetNoResponse{}, fmt.Errorf("error fetching MET Norway forecast: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached:
+		// Keep the cached data and extend its lifetime
+		metNoCache.Lock()
+		stored.expires = parseExpires(resp.Header.Get("Expires"), now)
+		metNoCache.Unlock()
+		return entry.data, nil
+	case resp.StatusCode != http.StatusOK:
+		return MetNoResponse{}, fmt.Errorf("MET Norway API error: status code %d", resp.StatusCode)
+	}
+
+	var data MetNoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return MetNoResponse{}, fmt.Errorf("error decoding MET Norway response: %w", err)
+	}
+
+	metNoCache.Lock()
+	pruneMetNoCache(now)
+	metNoCache.entries[urlStr] = &metNoCacheEntry{
+		data:         data,
+		lastModified: resp.Header.Get("Last-Modified"),
+		expires:      parseExpires(resp.Header.Get("Expires"), now),
+	}
+	metNoCache.Unlock()
+
+	return data, nil
+}
+
+// pruneMetNoCache makes room for a new response, dropping responses that
+// expired too long ago to be worth revalidating and, if the cache is still
+// full, those that expire first. The cache must be locked.
+func pruneMetNoCache(now time.Time) {
+	for url, entry := range metNoCache.entries {
+		if now.Sub(entry.expires) > metNoCacheRetention {
+			delete(metNoCache.entries, url)
+		}
+	}
+	if len(metNoCache.entries) < metNoCacheSize {
+		return
+	}
+
+	urls := make([]string, 0, len(metNoCache.entries))
+	for url := range metNoCache.entries {
+		urls = append(urls, url)
+	}
+	sort.Slice(urls, func(i, j int) bool {
+		return metNoCache.entries[urls[i]].expires.Before(metNoCache.entries[urls[j]].expires)
+	})
+	for _, url := range urls[:len(urls)-metNoCacheSize+1] {
+		delete(metNoCache.entries, url)
+	}
+}
+
+// parseExpires parses an HTTP Expires header, treating a missing or invalid
+// value as already expired
+func parseExpires(value string, now time.Time) time.Time {
+	expires, err := http.ParseTime(value)
+	if err != nil {
+		return now
+	}
+	return expires
+}
+
+// metNoZone returns the time zone of a location, so that the forecast is
+// bucketed into local calendar days; MET Norway reports times in UTC only. At
+// sea, where no zone applies, it is the nautical zone of the longitude.
+func metNoZone(lat, lon float64) *time.Location {
+	if name := latlong.LookupZoneName(lat, lon); name != "" {
+		if zone, err := time.LoadLocation(name); err == nil {
+			return zone
+		}
+	}
+	offset := int(math.Round(lon/15)) * 3600
+	return time.FixedZone("", offset)
+}
+
+// convertMetNo maps a MET Norway timeseries onto WeatherResponse, grouping
+// the hourly and six-hourly steps into daily min/max buckets. The hourly
+// steps also make up the hourly forecast.
+func convertMetNo(data MetNoResponse, zone *time.Location) (WeatherResponse, error) {
+	series := data.Properties.Timeseries
+	if len(series) == 0 {
+		return WeatherResponse{}, fmt.Errorf("MET Norway response contains no timeseries")
+	}
+
+	weather := WeatherResponse{Provider: "met-no"}
+
+	// Current conditions come from the first step
+	current := series[0].Data
+	weather.Current.Temp = current.Instant.Details.AirTemperature
+	if humidity := current.Instant.Details.RelativeHumidity; humidity != nil {
+		weather.Current.Humidity = ptr(int(*humidity))
+	}
+	weather.Current.WindSpeed = current.Instant.Details.WindSpeed
+	weather.Current.Pressure = current.Instant.Details.AirPressureAtSeaLevel
+	weather.Current.Weather = []struct {
+		Description string `json:"description"`
+	}{{Description: metNoDescription(metNoSymbol(current.Next1Hours, current.Next6Hours, current.Next12Hours))}}
+
+	// Group steps by local day
+	type dayBucket struct {
+		date        time.Time
+		hasTemp     bool
+		minTemp     float64
+		maxTemp     float64
+		precip      *float64
+		description string
+		noonOffset  time.Duration
+	}
+	dayMap := make(map[string]*dayBucket)
+
+	for _, step := range series {
+		stepTime, err := time.Parse(time.RFC3339, step.Time)
+		if err != nil {
+			continue
+		}
+		local := stepTime.In(zone)
+		dateKey := local.Format("2006-01-02")
+		temp := step.Data.Instant.Details.AirTemperature
+
+		// Hourly steps make up the hourly forecast. The compact format has no
+		// probability of precipitation.
+		if step.Data.Next1Hours != nil {
+			weather.Hourly = append(weather.Hourly, HourlyWeather{
+				Dt:        stepTime.Unix(),
+				Temp:      temp,
+				WindSpeed: step.Data.Instant.Details.WindSpeed,
+				Weather: []struct {
+					Description string `json:"description"`
+				}{{Description: metNoDescription(step.Data.Next1Hours.Summary.SymbolCode)}},
+			})
+		}
+
+		// Prefer the symbol for the step closest to local noon
+		symbol := metNoSymbol(step.Data.Next6Hours, step.Data.Next12Hours, step.Data.Next1Hours)
+		noon := time.Date(local.Year(), local.Month(), local.Day(), 12, 0, 0, 0, zone)
+		offset := local.Sub(noon)
+		if offset < 0 {
+			offset = -offset
+		}
+
+		// Steps are hourly at first and six-hourly later on, so use the
+		// shortest period to avoid counting precipitation twice
+		var precip *float64
+		if step.Data.Next1Hours != nil {
+			precip = step.Data.Next1Hours.Details.PrecipitationAmount
+		} else if step.Data.Next6Hours != nil {
+			precip = step.Data.Next6Hours.Details.PrecipitationAmount
+		}
+
+		day, exists := dayMap[dateKey]
+		if !exists {
+			day = &dayBucket{
+				date:        noon,
+				description: symbol,
+				noonOffset:  offset,
+			}
+			dayMap[dateKey] = day
+		}
+
+		// Six-hourly steps miss the afternoon peak and overnight low, so the
+		// extremes of each six-hour period count along with the instant
+		// temperature. Steps without a temperature still count towards
+		// precipitation.
+		temps := []*float64{temp}
+		if step.Data.Next6Hours != nil {
+			temps = append(temps, step.Data.Next6Hours.Details.AirTemperatureMin, step.Data.Next6Hours.Details.AirTemperatureMax)
+		}
+		for _, temp := range temps {
+			if temp == nil {
+				continue
+			}
+			if !day.hasTemp {
+				day.minTemp, day.maxTemp = *temp, *temp
+				day.hasTemp = true
+			}
+			day.minTemp = math.Min(day.minTemp, *temp)
+			day.maxTemp = math.Max(day.maxTemp, *temp)
+		}
+		day.precip = sumOptional(day.precip, precip)
+		if symbol != "" && (day.description == "" || offset < day.noonOffset) {
+			day.description = symbol
+			day.noonOffset = offset
+		}
+	}
+
+	// Sort days chronologically
+	days := make([]string, 0, len(dayMap))
+	for day := range dayMap {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+
+	for _, key := range days {
+		day := dayMap[key]
+		if !day.hasTemp {
+			continue
+		}
+		dailyData := struct {
+			Dt   int64 `json:"dt"`
+			Temp struct {
+				Min *float64 `json:"min"`
+				Max *float64 `json:"max"`
+			} `json:"temp"`
+			Weather []struct {
+				Description string `json:"description"`
+			} `json:"weather"`
+			Rain *float64 `json:"rain"`
+			Snow *float64 `json:"snow"`
+		}{
+			Dt: day.date.Unix(),
+			Weather: []struct {
+				Description string `json:"description"`
+			}{{Description: metNoDescription(day.description)}},
+		}
+		dailyData.Temp.Min = ptr(day.minTemp)
+		dailyData.Temp.Max = ptr(day.maxTemp)
+
+		// MET Norway doesn't distinguish rain from snow
+		dailyData.Rain = day.precip
+
+		weather.Daily = append(weather.Daily, dailyData)
+	}
+
+	return weather, nil
+}
+
+// metNoSymbol returns the first symbol code present in the given summaries
+func metNoSymbol(summaries ...*metNoSummary) string {
+	for _, summary := range summaries {
+		if summary != nil && summary.Summary.SymbolCode != "" {
+			return summary.Summary.SymbolCode
+		}
+	}
+	return ""
+}
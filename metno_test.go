@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const metNoFixture = `{
+  "type": "Feature",
+  "properties": {
+    "timeseries": [
+      {"time": "2026-10-16T10:00:00Z", "data": {
+        "instant": {"details": {"air_temperature": 10.0, "relative_humidity": 81.2, "wind_speed": 4.0}},
+        "next_1_hours": {"summary": {"symbol_code": "cloudy"}},
+        "next_6_hours": {"summary": {"symbol_code": "lightrain"}}}},
+      {"time": "2026-10-16T16:00:00Z", "data": {
+        "instant": {"details": {"air_temperature": 14.0, "relative_humidity": 70.0, "wind_speed": 5.0}},
+        "next_6_hours": {"summary": {"symbol_code": "partlycloudy_night"}}}},
+      {"time": "2026-10-17T06:00:00Z", "data": {
+        "instant": {"details": {"air_temperature": 5.0, "relative_humidity": 90.0, "wind_speed": 2.0}},
+        "next_6_hours": {"summary": {"symbol_code": "fog"}, "details": {"air_temperature_min": 3.5, "air_temperature_max": 9.0}}}},
+      {"time": "2026-10-17T12:00:00Z", "data": {
+        "instant": {"details": {"air_temperature": 15.0, "relative_humidity": 60.0, "wind_speed": 3.0}},
+        "next_6_hours": {"summary": {"symbol_code": "clearsky_day"}, "details": {"air_temperature_min": 12.0, "air_temperature_max": 17.5}}}}
+    ]
+  }
+}`
+
+func TestConvertMetNo(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(metNoFixture)) //nolint
+	}))
+	defer server.Close()
+
+	data, err := fetchMetNoForecast(context.Background(), server.URL, time.Now())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	weather, err := convertMetNo(data, time.UTC)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if *weather.Current.Temp != 10.0 {
+		t.Errorf("Expected current temperature 10.0°C, got %v", *weather.Current.Temp)
+	}
+	if *weather.Current.Humidity != 81 {
+		t.Errorf("Expected humidity 81, got %d", *weather.Current.Humidity)
+	}
+	if weather.Current.FeelsLike != nil {
+		t.Errorf("Expected no feels-like temperature, got %v", *weather.Current.FeelsLike)
+	}
+	if weather.Current.Weather[0].Description != "cloudy" {
+		t.Errorf("Expected current condition cloudy, got %s", weather.Current.Weather[0].Description)
+	}
+
+	if len(weather.Daily) != 2 {
+		t.Fatalf("Expected 2 daily buckets, got %d", len(weather.Daily))
+	}
+	day := weather.Daily[1]
+	// The six-hour extremes reach beyond the instant temperatures
+	if *day.Temp.Min != 3.5 || *day.Temp.Max != 17.5 {
+		t.Errorf("Expected min 3.5°C and max 17.5°C, got %v and %v", *day.Temp.Min, *day.Temp.Max)
+	}
+	if day.Weather[0].Description != "clear sky" {
+		t.Errorf("Expected the noon symbol clear sky, got %s", day.Weather[0].Description)
+	}
+
+	// Only the hourly steps make up the hourly forecast
+	if len(weather.Hourly) != 1 || weather.Hourly[0].Weather[0].Description != "cloudy" || weather.Hourly[0].Pop != nil {
+		t.Errorf("Expected one cloudy hour without a precipitation probability, got %+v", weather.Hourly)
+	}
+}
+
+func TestMetNoZone(t *testing.T) {
+	summer := time.Date(2026, 7, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		lat, lon float64
+		offset   time.Duration
+	}{
+		// China keeps one zone across its whole width
+		{"Chengdu", 30.66, 104.07, 8 * time.Hour},
+		{"Delhi", 28.61, 77.21, 5*time.Hour + 30*time.Minute},
+		{"Oslo in summer", 59.91, 10.75, 2 * time.Hour},
+		// At sea the nautical zone applies
+		{"mid-Atlantic", 30.0, -40.0, -3 * time.Hour},
+	}
+	for _, tt := range tests {
+		_, offset := summer.In(metNoZone(tt.lat, tt.lon)).Zone()
+		if time.Duration(offset)*time.Second != tt.offset {
+			t.Errorf("%s: expected offset %v, got %v", tt.name, tt.offset, time.Duration(offset)*time.Second)
+		}
+	}
+}
+
+func TestFetchMetNoForecastCaching(t *testing.T) {
+	lastModified := "Fri, 16 Oct 2026 10:00:00 GMT"
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if agent := r.Header.Get("User-Agent"); agent != "weathercli/1.0 ops@example.com" {
+			t.Errorf("Expected the configured User-Agent, got %q", agent)
+		}
+		w.Header().Set("Expires", "Fri, 16 Oct 2026 11:00:00 GMT")
+		if r.Header.Get("If-Modified-Since") == lastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write([]byte(metNoFixture)) //nolint
+	}))
+	defer server.Close()
+
+	defer func(e Endpoints, p URLPolicy, agent string) { endpoints, urlPolicy, userAgent = e, p, agent }(endpoints, urlPolicy, userAgent)
+	ConfigureEndpoints(&Config{UserAgent: "weathercli/1.0 ops@example.com"})
+
+	start := time.Date(2026, 10, 16, 10, 30, 0, 0, time.UTC)
+
+	// The first request populates the cache
+	if _, err := fetchMetNoForecast(context.Background(), server.URL, start); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// Before expiry the cache is served without a request
+	if _, err := fetchMetNoForecast(context.Background(), server.URL, start.Add(10*time.Minute)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if requests != 1 {
+		t.Errorf("Expected 1 request before expiry, got %d", requests)
+	}
+
+	// After expiry a conditional request revalidates the cached data
+	data, err := fetchMetNoForecast(context.Background(), server.URL, start.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if requests != 2 {
+		t.Errorf("Expected 2 requests after expiry, got %d", requests)
+	}
+	if len(data.Properties.Timeseries) != 4 {
+		t.Errorf("Expected cached timeseries on 304, got %d steps", len(data.Properties.Timeseries))
+	}
+}
+
+func TestPruneMetNoCache(t *testing.T) {
+	metNoCache.Lock()
+	defer metNoCache.Unlock()
+	saved := metNoCache.entries
+	defer func() { metNoCache.entries = saved }()
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	metNoCache.entries = map[string]*metNoCacheEntry{
+		"stale":  {expires: now.Add(-metNoCacheRetention - time.Minute)},
+		"recent": {expires: now.Add(-time.Minute)},
+	}
+	for i := 0; i < metNoCacheSize; i++ {
+		metNoCache.entries[fmt.Sprintf("fresh-%d", i)] = &metNoCacheEntry{expires: now.Add(time.Duration(i+1) * time.Minute)}
+	}
+
+	pruneMetNoCache(now)
+
+	// Responses long expired go first, then those expiring soonest, leaving
+	// room for one more
+	if len(metNoCache.entries) != metNoCacheSize-1 {
+		t.Errorf("Expected %d entries, got %d", metNoCacheSize-1, len(metNoCache.entries))
+	}
+	for _, url := range []string{"stale", "recent", "fresh-0"} {
+		if _, ok := metNoCache.entries[url]; ok {
+			t.Errorf("Expected %s to be evicted", url)
+		}
+	}
+	if _, ok := metNoCache.entries["fresh-1"]; !ok {
+		t.Error("Expected fresh-1 to be kept")
+	}
+}
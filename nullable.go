@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Measurements that a provider may not report are pointers, so that a missing
+// value (nil, null in JSON, an empty CSV cell) is distinct from a genuine zero.
+
+// ptr returns a pointer to a copy of v
+func ptr[T any](v T) *T {
+	return &v
+}
+
+// mapOptional applies a conversion to an optional value
+func mapOptional(v *float64, convert func(float64) float64) *float64 {
+	if v == nil {
+		return nil
+	}
+	return ptr(convert(*v))
+}
+
+// sumOptional adds optional values, treating missing ones as zero. The sum is
+// missing only if every value is.
+func sumOptional(values ...*float64) *float64 {
+	var sum *float64
+	for _, v := range values {
+		if v == nil {
+			continue
+		}
+		if sum == nil {
+			sum = ptr(0.0)
+		}
+		*sum += *v
+	}
+	return sum
+}
+
+// formatOptional formats an optional value with a fmt verb such as "%.1f",
+// returning an empty string if it is missing
+func formatOptional(format string, v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprintf(format, *v)
+}
+
+// formatOptionalInt formats an optional integer, returning an empty string if
+// it is missing
+func formatOptionalInt(v *int) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.Itoa(*v)
+}
+
+// describeOptional formats an optional value with its unit for text output,
+// returning "n/a" if it is missing
+func describeOptional(format string, v *float64, unit string) string {
+	if v == nil {
+		return "n/a"
+	}
+	return fmt.Sprintf(format, *v) + unit
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+)
+
+// OpenMeteoResponse is the subset of the Open-Meteo forecast response we use
+type OpenMeteoResponse struct {
+	UTCOffsetSeconds int `json:"utc_offset_seconds"`
+	Current          struct {
+		Temperature         *float64 `json:"temperature_2m"`
+		ApparentTemperature *float64 `json:"apparent_temperature"`
+		RelativeHumidity    *float64 `json:"relative_humidity_2m"`
+		WindSpeed           *float64 `json:"wind_speed_10m"`
+		Pressure            *float64 `json:"pressure_msl"`
+		WeatherCode         *int     `json:"weather_code"`
+	} `json:"current"`
+	Daily struct {
+		Time           []string   `json:"time"`
+		TemperatureMax []*float64 `json:"temperature_2m_max"`
+		TemperatureMin []*float64 `json:"temperature_2m_min"`
+		WeatherCode    []*int     `json:"weather_code"`
+		Precipitation  []*float64 `json:"precipitation_sum"`
+		Rain           []*float64 `json:"rain_sum"`
+		Showers        []*float64 `json:"showers_sum"`
+	} `json:"daily"`
+	Hourly struct {
+		Time                     []string   `json:"time"`
+		Temperature              []*float64 `json:"temperature_2m"`
+		PrecipitationProbability []*float64 `json:"precipitation_probability"`
+		WindSpeed                []*float64 `json:"wind_speed_10m"`
+		WeatherCode              []*int     `json:"weather_code"`
+	} `json:"hourly"`
+}
+
+// wmoDescriptions maps WMO weather interpretation codes to descriptions
+var wmoDescriptions = map[int]string{
+	0:  "clear sky",
+	1:  "mainly clear",
+	2:  "partly cloudy",
+	3:  "overcast",
+	45: "fog",
+	48: "depositing rime fog",
+	51: "light drizzle",
+	53: "moderate drizzle",
+	55: "dense drizzle",
+	56: "light freezing drizzle",
+	57: "dense freezing drizzle",
+	61: "slight rain",
+	63: "moderate rain",
+	65: "heavy rain",
+	66: "light freezing rain",
+	67: "heavy freezing rain",
+	71: "slight snow fall",
+	73: "moderate snow fall",
+	75: "heavy snow fall",
+	77: "snow grains",
+	80: "slight rain showers",
+	81: "moderate rain showers",
+	82: "violent rain showers",
+	85: "slight snow showers",
+	86: "heavy snow showers",
+	95: "thunderstorm",
+	96: "thunderstorm with slight hail",
+	99: "thunderstorm with heavy hail",
+}
+
+// wmoDescription returns the description for a WMO weather code
+func wmoDescription(code int) string {
+	if description, ok := wmoDescriptions[code]; ok {
+		return description
+	}
+	return fmt.Sprintf("weather code %d", code)
+}
+
+func init() {
+	RegisterProvider("open-meteo", newOpenMeteoProvider)
+}
+
+// openMeteoProvider fetches weather from the Open-Meteo forecast API
+type openMeteoProvider struct {
+	hours int
+}
+
+func newOpenMeteoProvider(config *Config) (WeatherProvider, error) {
+	return &openMeteoProvider{hours: config.Hourly}, nil
+}
+
+func (p *openMeteoProvider) Name() string {
+	return "open-meteo"
+}
+
+func (p *openMeteoProvider) GetWeather(ctx context.Context, lat, lon float64) (WeatherResponse, error) {
+	return getOpenMeteoWeather(ctx, lat, lon, p.hours)
+}
+
+// getOpenMeteoWeather fetches weather data from the Open-Meteo API, including
+// the given number of hours of hourly forecast
+func getOpenMeteoWeather(ctx context.Context, lat, lon float64, hours int) (WeatherResponse, error) {
+	urlStr := fmt.Sprintf("%s%s?latitude=%.4f&longitude=%.4f"+
+		"&current=temperature_2m,apparent_temperature,relative_humidity_2m,wind_speed_10m,pressure_msl,weather_code"+
+		"&daily=temperature_2m_max,temperature_2m_min,weather_code,precipitation_sum,rain_sum,showers_sum"+
+		"&wind_speed_unit=ms&timezone=auto&forecast_days=7",
+		endpoints.OpenMeteo, openMeteoEndpoint, lat, lon)
+	if hours > 0 {
+		urlStr += fmt.Sprintf("&hourly=temperature_2m,precipitation_probability,wind_speed_10m,weather_code&forecast_hours=%d", hours)
+	}
+
+	if err := validateURL(urlStr); err != nil {
+		return WeatherResponse{}, fmt.Errorf("URL validation failed: %w", err)
+	}
+
+	return fetchOpenMeteoWeather(ctx, urlStr)
+}
+
+// fetchOpenMeteoWeather requests an Open-Meteo forecast URL and converts the
+// response to our standard WeatherResponse format
+func fetchOpenMeteoWeather(ctx context.Context, urlStr string) (WeatherResponse, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return WeatherResponse{}, fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return WeatherResponse{}, fmt.Errorf("error fetching Open-Meteo forecast: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return WeatherResponse{}, fmt.Errorf("Open-Meteo API error: status code %d", resp.StatusCode)
+	}
+
+	var data OpenMeteoResponse
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
+		return WeatherResponse{}, fmt.Errorf("error decoding Open-Meteo response: %w", err)
+	}
+
+	return convertOpenMeteo(data)
+}
+
+// convertOpenMeteo maps an Open-Meteo response onto WeatherResponse
+func convertOpenMeteo(data OpenMeteoResponse) (WeatherResponse, error) {
+	weather := WeatherResponse{Provider: "open-meteo"}
+
+	// Current conditions
+	weather.Current.Temp = data.Current.Temperature
+	weather.Current.FeelsLike = data.Current.ApparentTemperature
+	if humidity := data.Current.RelativeHumidity; humidity != nil {
+		weather.Current.Humidity = ptr(int(*humidity))
+	}
+	weather.Current.WindSpeed = data.Current.WindSpeed
+	weather.Current.Pressure = data.Current.Pressure
+	if data.Current.WeatherCode != nil {
+		weather.Current.Weather = []struct {
+			Description string `json:"description"`
+		}{{Description: wmoDescription(*data.Current.WeatherCode)}}
+	}
+
+	// Daily forecast, with dates interpreted in the location's time zone
+	daily := data.Daily
+	if len(daily.TemperatureMax) != len(daily.Time) ||
+		len(daily.TemperatureMin) != len(daily.Time) {
+		return WeatherResponse{}, fmt.Errorf("Open-Meteo daily series have mismatched lengths")
+	}
+
+	zone := time.FixedZone("", data.UTCOffsetSeconds)
+	for i, dateStr := range daily.Time {
+		date, err := time.ParseInLocation("2006-01-02", dateStr, zone)
+		if err != nil {
+			return WeatherResponse{}, fmt.Errorf("invalid Open-Meteo date %q: %w", dateStr, err)
+		}
+
+		dailyData := struct {
+			Dt   int64 `json:"dt"`
+			Temp struct {
+				Min *float64 `json:"min"`
+				Max *float64 `json:"max"`
+			} `json:"temp"`
+			Weather []struct {
+				Description string `json:"description"`
+			} `json:"weather"`
+			Rain *float64 `json:"rain"`
+			Snow *float64 `json:"snow"`
+		}{
+			// Use local noon so the date survives conversion to other time zones
+			Dt: date.Add(12 * time.Hour).Unix(),
+			Weather: []struct {
+				Description string `json:"description"`
+			}{{Description: openMeteoCondition(daily.WeatherCode, i)}},
+		}
+		// The last days of the forecast can be null; they are kept, so
+		// that days aren't shifted, without a low or high
+		dailyData.Temp.Min = daily.TemperatureMin[i]
+		dailyData.Temp.Max = daily.TemperatureMax[i]
+
+		// Precipitation series are optional; whatever isn't rain is snow
+		if total := openMeteoValue(daily.Precipitation, i); total != nil {
+			rain := sumOptional(ptr(0.0), openMeteoValue(daily.Rain, i), openMeteoValue(daily.Showers, i))
+			dailyData.Rain = rain
+			dailyData.Snow = ptr(math.Max(*total-*rain, 0))
+		}
+
+		weather.Daily = append(weather.Daily, dailyData)
+	}
+
+	// Hourly times are local too
+	hourly := data.Hourly
+	for i, timeStr := range hourly.Time {
+		hourTime, err := time.ParseInLocation("2006-01-02T15:04", timeStr, zone)
+		if err != nil {
+			return WeatherResponse{}, fmt.Errorf("invalid Open-Meteo time %q: %w", timeStr, err)
+		}
+
+		hour := HourlyWeather{
+			Dt:        hourTime.Unix(),
+			Temp:      openMeteoValue(hourly.Temperature, i),
+			WindSpeed: openMeteoValue(hourly.WindSpeed, i),
+			Pop:       mapOptional(openMeteoValue(hourly.PrecipitationProbability, i), func(percent float64) float64 { return percent / 100 }),
+		}
+		if i < len(hourly.WeatherCode) && hourly.WeatherCode[i] != nil {
+			hour.Weather = []struct {
+				Description string `json:"description"`
+			}{{Description: wmoDescription(*hourly.WeatherCode[i])}}
+		}
+		weather.Hourly = append(weather.Hourly, hour)
+	}
+
+	return weather, nil
+}
+
+// openMeteoCondition describes the weather code for day i of the optional
+// daily series, or returns an empty string if there is none
+func openMeteoCondition(codes []*int, i int) string {
+	if i >= len(codes) || codes[i] == nil {
+		return ""
+	}
+	return wmoDescription(*codes[i])
+}
+
+// openMeteoValue returns the value for day i of an optional daily series, or
+// nil if the series is missing or has no value for that day
+func openMeteoValue(series []*float64, i int) *float64 {
+	if i >= len(series) {
+		return nil
+	}
+	return series[i]
+}
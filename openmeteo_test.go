@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const openMeteoFixture = `{
+  "latitude": 51.5,
+  "longitude": -0.12,
+  "utc_offset_seconds": 3600,
+  "current": {
+    "time": "2026-10-16T14:00",
+    "temperature_2m": 14.6,
+    "apparent_temperature": 12.8,
+    "relative_humidity_2m": 72,
+    "wind_speed_10m": 4.2,
+    "weather_code": 3
+  },
+  "daily": {
+    "time": ["2026-10-16", "2026-10-17", "2026-10-18"],
+    "temperature_2m_max": [15.6, 16.9, 13.9],
+    "temperature_2m_min": [9.0, 10.0, 7.5],
+    "weather_code": [3, 61, 999]
+  },
+  "hourly": {
+    "time": ["2026-10-16T14:00", "2026-10-16T15:00"],
+    "temperature_2m": [14.6, null],
+    "precipitation_probability": [20, 45],
+    "wind_speed_10m": [4.2, 4.8],
+    "weather_code": [3, 61]
+  }
+}`
+
+func TestFetchOpenMeteoWeather(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("latitude") != "51.5000" {
+			t.Errorf("Expected latitude 51.5000, got %s", r.URL.Query().Get("latitude"))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(openMeteoFixture)) //nolint
+	}))
+	defer server.Close()
+
+	weather, err := fetchOpenMeteoWeather(context.Background(), server.URL+"?latitude=51.5000&longitude=-0.1200")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if weather.Provider != "open-meteo" {
+		t.Errorf("Expected provider open-meteo, got %s", weather.Provider)
+	}
+	if *weather.Current.Temp != 14.6 || *weather.Current.FeelsLike != 12.8 {
+		t.Errorf("Unexpected current temperatures: %v, %v", *weather.Current.Temp, *weather.Current.FeelsLike)
+	}
+	if *weather.Current.Humidity != 72 {
+		t.Errorf("Expected humidity 72, got %d", *weather.Current.Humidity)
+	}
+	if weather.Current.Weather[0].Description != "overcast" {
+		t.Errorf("Expected condition overcast, got %s", weather.Current.Weather[0].Description)
+	}
+
+	if len(weather.Daily) != 3 {
+		t.Fatalf("Expected 3 daily entries, got %d", len(weather.Daily))
+	}
+	day := weather.Daily[1]
+	if *day.Temp.Min != 10.0 || *day.Temp.Max != 16.9 {
+		t.Errorf("Unexpected daily temperatures: %v, %v", *day.Temp.Min, *day.Temp.Max)
+	}
+	if day.Weather[0].Description != "slight rain" {
+		t.Errorf("Expected condition slight rain, got %s", day.Weather[0].Description)
+	}
+	date := time.Unix(day.Dt, 0).In(time.FixedZone("", 3600)).Format("2006-01-02")
+	if date != "2026-10-17" {
+		t.Errorf("Expected date 2026-10-17, got %s", date)
+	}
+	if weather.Daily[2].Weather[0].Description != "weather code 999" {
+		t.Errorf("Expected fallback description for unknown code, got %s", weather.Daily[2].Weather[0].Description)
+	}
+
+	if len(weather.Hourly) != 2 {
+		t.Fatalf("Expected 2 hourly entries, got %d", len(weather.Hourly))
+	}
+	hour := weather.Hourly[1]
+	if hour.Dt != time.Date(2026, 10, 16, 14, 0, 0, 0, time.UTC).Unix() {
+		t.Errorf("Expected the second hour to start at 14:00 UTC, got %v", time.Unix(hour.Dt, 0).UTC())
+	}
+	if hour.Temp != nil || hour.Pop == nil || *hour.Pop != 0.45 || hour.Weather[0].Description != "slight rain" {
+		t.Errorf("Expected a missing temperature and a 0.45 chance of slight rain, got %+v", hour)
+	}
+}
+
+func TestConvertOpenMeteoMissingValues(t *testing.T) {
+	var data OpenMeteoResponse
+	data.Current.Temperature = ptr(14.6)
+	data.Daily.Time = []string{"2026-10-16", "2026-10-17"}
+	data.Daily.TemperatureMin = []*float64{ptr(9.0), ptr(10.0)}
+	data.Daily.TemperatureMax = []*float64{ptr(15.6), nil}
+	data.Daily.WeatherCode = []*int{nil, ptr(61)}
+
+	weather, err := convertOpenMeteo(data)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// A missing weather code isn't code 0, clear sky
+	if len(weather.Current.Weather) != 0 {
+		t.Errorf("Expected no current condition, got %v", weather.Current.Weather)
+	}
+	if weather.Daily[0].Weather[0].Description != "" || weather.Daily[1].Weather[0].Description != "slight rain" {
+		t.Errorf("Expected no condition on the first day only, got %+v", weather.Daily)
+	}
+
+	// A day without a high is kept, with only its low
+	if len(weather.Daily) != 2 || weather.Daily[1].Temp.Max != nil || *weather.Daily[1].Temp.Min != 10.0 {
+		t.Errorf("Expected the second day with a low of 10°C and no high, got %+v", weather.Daily)
+	}
+}
+
+func TestFetchOpenMeteoWeatherError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":true,"reason":"Latitude must be in range of -90 to 90°."}`, http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	if _, err := fetchOpenMeteoWeather(context.Background(), server.URL); err == nil {
+		t.Error("Expected error for non-200 response, got nil")
+	}
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/parquet-go/parquet-go/compress"
+)
+
+// parquetCodecs maps -parquet-compression values to the codec of the column
+// chunks; snappy is the default
+var parquetCodecs = map[string]compress.Codec{
+	"":              &parquet.Snappy,
+	compressionNone: &parquet.Uncompressed,
+	"snappy":        &parquet.Snappy,
+	compressionZstd: &parquet.Zstd,
+}
+
+// parquetOptions are the settings of Parquet files: the column compression
+// and the most rows in a row group, where zero means one row group per file
+type parquetOptions struct {
+	compression  string
+	rowGroupSize int64
+}
+
+// parquetOptions returns the Parquet settings of the configuration
+func (c *Config) parquetOptions() parquetOptions {
+	return parquetOptions{compression: c.ParquetCompression, rowGroupSize: c.ParquetRowGroupSize}
+}
+
+// validateParquetOptions checks the Parquet compression and row group size
+func validateParquetOptions(options parquetOptions) error {
+	if _, ok := parquetCodecs[options.compression]; !ok {
+		return fmt.Errorf("invalid Parquet compression: %s (use none, snappy or zstd)", options.compression)
+	}
+	if options.rowGroupSize < 0 {
+		return fmt.Errorf("parquet row group size must not be negative")
+	}
+	return nil
+}
+
+// parquetRecord is the schema of Parquet output: one row per location, with
+// the daily and hourly forecast and the alerts as nested lists. The schema
+// doesn't depend on the data or the units, which are recorded in columns of
+// their own, so that every file of a dataset can be loaded into one table.
+// Times are UTC timestamps in microseconds; optional times are int64 fields,
+// as the timestamp tag only applies to int64 and time.Time, and zero is
+// written as null. Columns are only ever added to the end.
+type parquetRecord struct {
+	LocationID   string    `parquet:"location_id"`
+	LocationName string    `parquet:"location_name"`
+	Latitude     float64   `parquet:"latitude"`
+	Longitude    float64   `parquet:"longitude"`
+	Timestamp    time.Time `parquet:"timestamp,timestamp(microsecond)"`
+	Temperature  *float64  `parquet:"temperature,optional"`
+	FeelsLike    *float64  `parquet:"feels_like,optional"`
+	TempMin      *float64  `parquet:"temp_min,optional"`
+	TempMax      *float64  `parquet:"temp_max,optional"`
+	Humidity     *int32    `parquet:"humidity,optional"`
+	WindSpeed    *float64  `parquet:"wind_speed,optional"`
+	Pressure     *float64  `parquet:"pressure,optional"`
+	Condition    string    `parquet:"condition"`
+	Summary      string    `parquet:"summary"`
+	Source       string    `parquet:"source"`
+	IsMetric     bool      `parquet:"is_metric"`
+
+	TemperatureUnit   string `parquet:"temperature_unit"`
+	WindSpeedUnit     string `parquet:"wind_speed_unit"`
+	PressureUnit      string `parquet:"pressure_unit"`
+	PrecipitationUnit string `parquet:"precipitation_unit"`
+
+	Station    string `parquet:"station"`
+	ObservedAt int64  `parquet:"observed_at,timestamp(microsecond),optional"`
+
+	Forecast []parquetForecastDay `parquet:"forecast,list"`
+	Hourly   []parquetHour        `parquet:"hourly,list"`
+	Alerts   []parquetAlert       `parquet:"alerts,list"`
+}
+
+// parquetForecastDay is a day of the daily forecast
+type parquetForecastDay struct {
+	Date          int32    `parquet:"date,date"`
+	TempMin       *float64 `parquet:"temp_min,optional"`
+	TempMax       *float64 `parquet:"temp_max,optional"`
+	Condition     string   `parquet:"condition"`
+	Precipitation *float64 `parquet:"precipitation,optional"`
+}
+
+// parquetHour is an hour of the hourly forecast
+type parquetHour struct {
+	Time              time.Time `parquet:"time,timestamp(microsecond)"`
+	Temperature       *float64  `parquet:"temperature,optional"`
+	PrecipProbability *int32    `parquet:"precip_probability,optional"`
+	WindSpeed         *float64  `parquet:"wind_speed,optional"`
+	Condition         string    `parquet:"condition"`
+}
+
+// parquetAlert is a weather alert in effect at the location
+type parquetAlert struct {
+	ID          string `parquet:"id"`
+	Event       string `parquet:"event"`
+	Headline    string `parquet:"headline"`
+	Description string `parquet:"description"`
+	Severity    string `parquet:"severity"`
+	Urgency     string `parquet:"urgency"`
+	Certainty   string `parquet:"certainty"`
+	Onset       int64  `parquet:"onset,timestamp(microsecond),optional"`
+	Expires     int64  `parquet:"expires,timestamp(microsecond),optional"`
+	Sender      string `parquet:"sender"`
+}
+
+// int32Optional converts an optional count, like humidity, to the column type
+func int32Optional(value *int) *int32 {
+	if value == nil {
+		return nil
+	}
+	return ptr(int32(*value))
+}
+
+// parquetTime converts an optional time to microseconds since the Unix epoch,
+// or zero, which is written as null, if it is missing
+func parquetTime(t *time.Time) int64 {
+	if t == nil {
+		return 0
+	}
+	return t.UnixMicro()
+}
+
+// parquetDate returns a calendar date as the days since the Unix epoch
+func parquetDate(t time.Time) int32 {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return int32(day.Unix() / (24 * 60 * 60))
+}
+
+// newParquetRecord converts a weather record to a Parquet row
+func newParquetRecord(data WeatherData) parquetRecord {
+	record := parquetRecord{
+		LocationID:        data.LocationID,
+		LocationName:      data.LocationName,
+		Latitude:          data.Latitude,
+		Longitude:         data.Longitude,
+		Timestamp:         data.Timestamp,
+		Temperature:       data.Temperature,
+		FeelsLike:         data.FeelsLike,
+		TempMin:           data.TempMin,
+		TempMax:           data.TempMax,
+		Humidity:          int32Optional(data.Humidity),
+		WindSpeed:         data.WindSpeed,
+		Pressure:          data.Pressure,
+		Condition:         data.Condition,
+		Summary:           data.Summary,
+		Source:            data.Source,
+		IsMetric:          data.IsMetric,
+		TemperatureUnit:   string(data.Units.Temperature),
+		WindSpeedUnit:     string(data.Units.Wind),
+		PressureUnit:      string(data.Units.Pressure),
+		PrecipitationUnit: string(data.Units.Precipitation),
+		Station:           data.Station,
+		ObservedAt:        parquetTime(data.ObservedAt),
+	}
+
+	for _, day := range data.Forecast {
+		record.Forecast = append(record.Forecast, parquetForecastDay{
+			Date:          parquetDate(day.Date),
+			TempMin:       day.TempMin,
+			TempMax:       day.TempMax,
+			Condition:     day.Condition,
+			Precipitation: day.Precipitation,
+		})
+	}
+	for _, hour := range data.Hourly {
+		record.Hourly = append(record.Hourly, parquetHour{
+			Time:              hour.Time,
+			Temperature:       hour.Temperature,
+			PrecipProbability: int32Optional(hour.PrecipProbability),
+			WindSpeed:         hour.WindSpeed,
+			Condition:         hour.Condition,
+		})
+	}
+	for _, alert := range data.Alerts {
+		record.Alerts = append(record.Alerts, parquetAlert{
+			ID:          alert.ID,
+			Event:       alert.Event,
+			Headline:    alert.Headline,
+			Description: alert.Description,
+			Severity:    alert.Severity,
+			Urgency:     alert.Urgency,
+			Certainty:   alert.Certainty,
+			Onset:       parquetTime(alert.Onset),
+			Expires:     parquetTime(alert.Expires),
+			Sender:      alert.Sender,
+		})
+	}
+	return record
+}
+
+// newParquetSink writes a run's records as a Parquet file. Parquet is a
+// binary format read by seeking to its footer, so it is only written to
+// files. Columns are compressed with -parquet-compression; -output-compression
+// doesn't apply.
+func newParquetSink(target string, config *Config) (Sink, error) {
+	if isStdout(target) {
+		return nil, fmt.Errorf("parquet output needs a file path")
+	}
+	options := config.parquetOptions()
+	if err := validateParquetOptions(options); err != nil {
+		return nil, err
+	}
+	return newBatchSink(target, config, func(path, compression string, dataList []WeatherData) error {
+		return writeParquetFile(path, options, dataList)
+	})
+}
+
+// writeParquetFile writes records as a Parquet file, starting a new row group
+// every rowGroupSize rows if set
+func writeParquetFile(path string, options parquetOptions, dataList []WeatherData) error {
+	output, err := createAtomicFile(path, compressionNone)
+	if err != nil {
+		return err
+	}
+
+	writerOptions := []parquet.WriterOption{parquet.Compression(parquetCodecs[options.compression])}
+	if options.rowGroupSize > 0 {
+		writerOptions = append(writerOptions, parquet.MaxRowsPerRowGroup(options.rowGroupSize))
+	}
+	writer := parquet.NewGenericWriter[parquetRecord](output, writerOptions...)
+
+	records := make([]parquetRecord, len(dataList))
+	for i, data := range dataList {
+		records[i] = newParquetRecord(data)
+	}
+	if _, err := writer.Write(records); err != nil {
+		output.Abort()
+		return fmt.Errorf("error writing Parquet: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		output.Abort()
+		return fmt.Errorf("error writing Parquet: %w", err)
+	}
+	return output.Close()
+}
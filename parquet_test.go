@@ -0,0 +1,118 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestParquetFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "weather.parquet")
+
+	data := csvTestData()
+	data.Humidity = ptr(40)
+	data.Hourly = []HourlyForecast{{Time: data.Timestamp, Temperature: ptr(66.0), PrecipProbability: ptr(10)}}
+	data.Alerts = []WeatherAlert{{Event: "Wind Advisory", Severity: "Moderate", Expires: ptr(data.Timestamp.Add(6 * time.Hour))}}
+	other := WeatherData{LocationID: "zip:10001", Timestamp: data.Timestamp, ObservedAt: ptr(data.Timestamp.Add(-time.Minute))}
+	dataList := []WeatherData{data, other, other}
+
+	options := parquetOptions{compression: compressionZstd, rowGroupSize: 2}
+	if err := writeParquetFile(path, options, dataList); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	rows, err := parquet.ReadFile[parquetRecord](path)
+	if err != nil {
+		t.Fatalf("Expected a valid Parquet file, got: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("Expected 3 rows, got %d", len(rows))
+	}
+
+	row := rows[0]
+	if row.LocationID != "zip:80202" || !row.Timestamp.Equal(data.Timestamp) || *row.Temperature != 68 || *row.Humidity != 40 {
+		t.Errorf("Unexpected current conditions: %+v", row)
+	}
+	if row.FeelsLike != nil || row.ObservedAt != 0 {
+		t.Errorf("Expected missing values to be null, got %v and %v", row.FeelsLike, row.ObservedAt)
+	}
+	if row.TemperatureUnit != "F" || row.PrecipitationUnit != "in" {
+		t.Errorf("Expected the units in their columns, got %s and %s", row.TemperatureUnit, row.PrecipitationUnit)
+	}
+
+	// Dates are days since the epoch
+	if len(row.Forecast) != 2 || row.Forecast[1].Date != parquetDate(data.Forecast[1].Date) || *row.Forecast[1].Precipitation != 0.25 {
+		t.Errorf("Unexpected forecast: %+v", row.Forecast)
+	}
+	if row.Forecast[0].Precipitation != nil {
+		t.Errorf("Expected no precipitation on the first day, got %v", *row.Forecast[0].Precipitation)
+	}
+	if time.Unix(int64(row.Forecast[0].Date)*24*60*60, 0).UTC().Format("2006-01-02") != "2026-10-16" {
+		t.Errorf("Expected the first day to be 2026-10-16, got %d", row.Forecast[0].Date)
+	}
+	if len(row.Hourly) != 1 || *row.Hourly[0].PrecipProbability != 10 || row.Hourly[0].WindSpeed != nil {
+		t.Errorf("Unexpected hourly forecast: %+v", row.Hourly)
+	}
+	if len(row.Alerts) != 1 || row.Alerts[0].Event != "Wind Advisory" || row.Alerts[0].Onset != 0 || row.Alerts[0].Expires != data.Timestamp.Add(6*time.Hour).UnixMicro() {
+		t.Errorf("Unexpected alerts: %+v", row.Alerts)
+	}
+	if len(rows[1].Forecast) != 0 || rows[1].Temperature != nil {
+		t.Errorf("Expected an empty record to have no values, got %+v", rows[1])
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	defer file.Close()
+	info, _ := file.Stat()
+	parquetFile, err := parquet.OpenFile(file, info.Size())
+	if err != nil {
+		t.Fatalf("Expected a valid Parquet file, got: %v", err)
+	}
+	if groups := len(parquetFile.RowGroups()); groups != 2 {
+		t.Errorf("Expected 2 row groups of at most 2 rows, got %d", groups)
+	}
+
+	// Times are microsecond timestamps, which warehouses load natively
+	schema := parquetFile.Schema().String()
+	for _, column := range []string{"required int64 timestamp", "optional int64 observed_at", "required int64 time", "optional int64 onset"} {
+		if !strings.Contains(schema, column+" (TIMESTAMP(isAdjustedToUTC=true,unit=MICROS))") {
+			t.Errorf("Expected %s to be a microsecond timestamp, got:\n%s", column, schema)
+		}
+	}
+	if observedAt := rows[1].ObservedAt; observedAt != data.Timestamp.Add(-time.Minute).UnixMicro() {
+		t.Errorf("Expected the observation time in microseconds, got %d", observedAt)
+	}
+
+	// A missing time is a null, not the epoch
+	column, _ := parquetFile.Schema().Lookup("observed_at")
+	page, err := parquetFile.RowGroups()[0].ColumnChunks()[column.ColumnIndex].Pages().ReadPage()
+	if err != nil || page.NumNulls() != 1 {
+		t.Errorf("Expected one null observation time in the first row group, got %v (%v)", page, err)
+	}
+}
+
+func TestParquetSinkOptions(t *testing.T) {
+	config := &Config{ParquetCompression: "snappy"}
+	if _, err := newParquetSink("/data/weather.parquet", config); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+	if _, err := newParquetSink("-", config); err == nil {
+		t.Error("Expected Parquet output to stdout to be rejected")
+	}
+
+	invalid := []*Config{
+		{ParquetCompression: "gzip"},
+		{ParquetCompression: "snappy", ParquetRowGroupSize: -1},
+	}
+	for _, config := range invalid {
+		if _, err := newParquetSink("/data/weather.parquet", config); err == nil {
+			t.Errorf("Expected compression %q with row group size %d to be rejected", config.ParquetCompression, config.ParquetRowGroupSize)
+		}
+	}
+}
@@ -1,362 +1,907 @@
 package main
 
 import (
+	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
+
+	"weathercli/units"
 )
 
+// maxForecastDays is the most forecast days kept after today
+const maxForecastDays = 6
+
 // OutputFormat defines the format for data output
 type OutputFormat string
 
 const (
-	FormatJSON  OutputFormat = "json"
-	FormatCSV   OutputFormat = "csv"
-	FormatText  OutputFormat = "text"
-	FormatKafka OutputFormat = "kafka"
+	FormatJSON    OutputFormat = "json"
+	FormatNDJSON  OutputFormat = "ndjson"
+	FormatCSV     OutputFormat = "csv"
+	FormatText    OutputFormat = "text"
+	FormatKafka   OutputFormat = "kafka"
+	FormatParquet OutputFormat = "parquet"
 )
 
 // Config holds application configuration
 type Config struct {
+	// ConfigFile is the file of flags given with -config, if any
+	ConfigFile string
+
+	// Args holds the positional command line arguments
+	Args []string
+
 	APIKey       string
+	Provider     string
+	Providers    []string
 	ZipCodes     []string
+	Locations    []string
 	OutputFormat OutputFormat
 	OutputPath   string
 	IsMetric     bool
+	UnitsSpec    string
 	KafkaBroker  string
 	KafkaTopic   string
 	Interval     time.Duration
 	Verbose      bool
+
+	// Outputs given with -sink as format:target; empty means the single
+	// output selected by -format and -output
+	Sinks []string
+
+	// CSV layout, wide or long, and the columns to write; empty means all
+	CSVLayout  string
+	CSVColumns []string
+
+	// Compression of finished output files, and when NDJSON files are rotated;
+	// zero means never
+	OutputCompression string
+	RotateSize        int64
+	RotateInterval    time.Duration
+
+	// Compression of Parquet columns, and the most rows in a Parquet row
+	// group; zero means one row group per file
+	ParquetCompression  string
+	ParquetRowGroupSize int64
+
+	// Kafka topic alerts are sent to, one message per alert, and producer
+	// settings
+	KafkaAlertsTopic   string
+	KafkaAcks          string
+	KafkaCompression   string
+	KafkaLinger        time.Duration
+	KafkaBatchBytes    int
+	KafkaTLS           bool
+	KafkaTLSCA         string
+	KafkaTLSCert       string
+	KafkaTLSKey        string
+	KafkaSASLMechanism string
+	KafkaSASLUsername  string
+	KafkaSASLPassword  string
+
+	// Hours of hourly forecast to include; zero leaves it out
+	Hourly int
+
+	// Number of locations fetched in parallel and the per-host request rate
+	Concurrency int
+	RateLimit   float64
+
+	// Upstream request timeouts and retries
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+	MaxRetries     int
+
+	// Directory to record upstream responses to, or to replay them from
+	RecordDir string
+	ReplayDir string
+
+	// Deadlines for each location and for each run; zero means no deadline
+	LocationTimeout time.Duration
+	RunTimeout      time.Duration
+
+	// Time the current run may keep going after SIGINT or SIGTERM
+	ShutdownTimeout time.Duration
+
+	// Upstream base URL overrides; empty means the public API
+	OWMBaseURL                string
+	NWSBaseURL                string
+	OpenMeteoBaseURL          string
+	OpenMeteoGeocodingBaseURL string
+	MetNoBaseURL              string
+	OpenAIBaseURL             string
+
+	// UserAgent identifies the client to the APIs, with contact details as
+	// MET Norway requires; a generic one is sent when it is empty
+	UserAgent string
+
+	// Hosts upstream requests may go to, replacing the default list, and
+	// whether plain HTTP is allowed
+	AllowedHosts []string
+	AllowHTTP    bool
+
+	// ZipSearch sends ZIP codes missing from the offline gazetteer to the
+	// Open-Meteo postal code search
+	ZipSearch bool
+
+	// Persistent geocoding cache; disabled when CacheDir is empty
+	CacheDir string
+	CacheTTL time.Duration
+
+	// Circuit breaker settings for the provider chain
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// ParsedLocations returns the configured ZIP codes followed by the other
+// locations, parsed into Location values
+func (c *Config) ParsedLocations() ([]Location, error) {
+	var locations []Location
+
+	for _, zip := range c.ZipCodes {
+		loc, err := parseZipLocation(strings.TrimSpace(zip))
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, loc)
+	}
+
+	for _, input := range c.Locations {
+		loc, err := ParseLocation(input)
+		if err != nil {
+			return nil, err
+		}
+		locations = append(locations, loc)
+	}
+
+	return locations, nil
+}
+
+// stringList is a flag.Value that collects every occurrence of a repeated flag
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, " ")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// Units returns the output units: metric or imperial depending on IsMetric,
+// with any per-quantity overrides from UnitsSpec applied
+func (c *Config) Units() (units.Spec, error) {
+	base := units.Imperial()
+	if c.IsMetric {
+		base = units.Metric()
+	}
+	return units.Parse(c.UnitsSpec, base)
 }
 
 // ParseFlags parses command line flags and returns a Config
 func ParseFlags() *Config {
+	config, err := LoadConfig(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		log.Fatalf("Configuration error: %v", err)
+	}
+
+	// Log API choice
+	if config.APIKey == "" && config.Provider == "" && len(config.Providers) == 0 {
+		log.Println("No OpenWeatherMap API key provided. Using National Weather Service API as fallback.")
+	}
+
+	return config
+}
+
+// LoadConfig builds a Config from command line arguments. Flags read from the
+// file named by -config are applied first, so the command line overrides them.
+// Usage and parse errors are written to output.
+func LoadConfig(args []string, output io.Writer) (*Config, error) {
+	config, err := parseConfigArgs(args, output)
+	if err != nil || config.ConfigFile == "" {
+		return config, err
+	}
+
+	fileArgs, err := readConfigFile(config.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	return parseConfigArgs(append(fileArgs, args...), output)
+}
+
+// readConfigFile reads a config file of one flag per line, such as
+// "zip-codes=90210,10001" or "-metric". Blank lines and lines starting with #
+// are ignored.
+func readConfigFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config file: %w", err)
+	}
+
+	var args []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if !strings.HasPrefix(line, "-") {
+			line = "-" + line
+		}
+		args = append(args, line)
+	}
+	return args, nil
+}
+
+// parseConfigArgs parses command line arguments into a Config
+func parseConfigArgs(args []string, output io.Writer) (*Config, error) {
 	config := &Config{}
+	fs := flag.NewFlagSet("weathercli", flag.ContinueOnError)
+	fs.SetOutput(output)
 
 	// Define flags
-	flag.StringVar(&config.APIKey, "api-key", os.Getenv("OWM_API_KEY"), "OpenWeatherMap API key (if not provided, National Weather Service API will be used)")
-	zipCodesStr := flag.String("zip-codes", "", "Comma-separated list of ZIP codes")
-	format := flag.String("format", "text", "Output format: text, json, csv, kafka")
-	flag.StringVar(&config.OutputPath, "output", "", "Output file path (stdout if empty)")
-	flag.BoolVar(&config.IsMetric, "metric", false, "Use metric units (Celsius)")
-	flag.StringVar(&config.KafkaBroker, "kafka-broker", "localhost:9092", "Kafka broker address")
-	flag.StringVar(&config.KafkaTopic, "kafka-topic", "weather-data", "Kafka topic for output")
-	interval := flag.Int("interval", 0, "Polling interval in seconds (0 for one-time run)")
-	flag.BoolVar(&config.Verbose, "verbose", false, "Enable verbose logging")
+	fs.StringVar(&config.ConfigFile, "config", "", "File of flags, one per line, re-read on SIGHUP (command line flags take precedence)")
+	fs.StringVar(&config.APIKey, "api-key", os.Getenv("OWM_API_KEY"), "OpenWeatherMap API key (if not provided, National Weather Service API will be used)")
+	fs.StringVar(&config.Provider, "provider", "", "Weather provider: "+strings.Join(ProviderNames(), ", ")+" (owm if an API key is set, nws otherwise)")
+	providersStr := fs.String("providers", "", "Comma-separated provider fallback chain, tried in order (overrides -provider)")
+	fs.IntVar(&config.BreakerThreshold, "breaker-threshold", defaultBreakerThreshold, "Consecutive failures before a provider is temporarily skipped")
+	breakerCooldown := fs.Int("breaker-cooldown", int(defaultBreakerCooldown/time.Second), "Seconds to skip a provider after its breaker trips")
+	zipCodesStr := fs.String("zip-codes", "", "Comma-separated list of ZIP codes")
+	var locations stringList
+	fs.Var(&locations, "location", "Location as zip:90210, zip:90210-1234, lat,lon, city:Denver,CO or icao:KDEN (repeatable)")
+	format := fs.String("format", "text", "Output format: "+strings.Join(SinkFormats(), ", "))
+	fs.StringVar(&config.OutputPath, "output", "", "Output file path (stdout if empty)")
+	var sinks stringList
+	fs.Var(&sinks, "sink", "Output as format:target, e.g. json:/data/out.json, kafka:weather-data or text:- (repeatable; overrides -format and -output)")
+	fs.StringVar(&config.CSVLayout, "csv-layout", csvLayoutWide, "CSV layout: wide (forecast days as columns) or long (a row per forecast day)")
+	csvColumnsStr := fs.String("csv-columns", "", "Comma-separated CSV columns to write, in order (all if empty)")
+	fs.StringVar(&config.OutputCompression, "output-compression", compressionNone, "Compression of output files: none, gzip or zstd")
+	fs.Int64Var(&config.RotateSize, "rotate-size", 0, "Bytes after which an NDJSON output file is finished and a new one started (0 for no limit)")
+	rotateInterval := fs.Int("rotate-interval", 0, "Seconds after which an NDJSON output file is finished and a new one started (0 for no limit)")
+	fs.StringVar(&config.ParquetCompression, "parquet-compression", "snappy", "Parquet column compression: none, snappy or zstd")
+	fs.Int64Var(&config.ParquetRowGroupSize, "parquet-row-group-size", 0, "Most rows in a Parquet row group (0 for one row group per file)")
+	fs.BoolVar(&config.IsMetric, "metric", false, "Use metric units (Celsius, m/s)")
+	fs.StringVar(&config.UnitsSpec, "units", "", "Per-quantity units overriding -metric, e.g. temperature=C,wind=kmh|ms|mph|kn|beaufort,pressure=hpa|inhg,precip=mm|in")
+	fs.IntVar(&config.Hourly, "hourly", 0, "Hours of hourly forecast to include (0 to leave it out)")
+	fs.StringVar(&config.KafkaBroker, "kafka-broker", "localhost:9092", "Comma-separated Kafka broker addresses")
+	fs.StringVar(&config.KafkaTopic, "kafka-topic", "weather-data", "Kafka topic for output")
+	fs.StringVar(&config.KafkaAlertsTopic, "kafka-alerts-topic", "weather-alerts", "Kafka topic for weather alerts, one message per alert")
+	fs.StringVar(&config.KafkaAcks, "kafka-acks", "all", "Kafka acknowledgements to wait for: all, leader or none")
+	fs.StringVar(&config.KafkaCompression, "kafka-compression", "snappy", "Kafka batch compression: none, gzip, snappy, lz4 or zstd")
+	kafkaLinger := fs.Int("kafka-linger-ms", int(defaultKafkaLinger/time.Millisecond), "Milliseconds to wait for more records before sending a Kafka batch")
+	fs.IntVar(&config.KafkaBatchBytes, "kafka-batch-bytes", defaultKafkaBatchBytes, "Largest Kafka batch sent to a partition, in bytes")
+	fs.BoolVar(&config.KafkaTLS, "kafka-tls", false, "Connect to Kafka brokers over TLS")
+	fs.StringVar(&config.KafkaTLSCA, "kafka-tls-ca", "", "PEM file of CA certificates for Kafka brokers (system roots if empty)")
+	fs.StringVar(&config.KafkaTLSCert, "kafka-tls-cert", "", "PEM client certificate for Kafka TLS authentication")
+	fs.StringVar(&config.KafkaTLSKey, "kafka-tls-key", "", "PEM client key for Kafka TLS authentication")
+	fs.StringVar(&config.KafkaSASLMechanism, "kafka-sasl-mechanism", "", "Kafka SASL mechanism: plain, scram-sha-256 or scram-sha-512 (disabled if empty)")
+	fs.StringVar(&config.KafkaSASLUsername, "kafka-sasl-username", "", "Kafka SASL username")
+	fs.StringVar(&config.KafkaSASLPassword, "kafka-sasl-password", "", "Kafka SASL password (defaults to $KAFKA_SASL_PASSWORD)")
+	interval := fs.Int("interval", 0, "Polling interval in seconds (0 for one-time run)")
+	fs.BoolVar(&config.Verbose, "verbose", false, "Enable verbose logging")
+	fs.IntVar(&config.Concurrency, "concurrency", 1, "Number of locations to fetch in parallel")
+	fs.Float64Var(&config.RateLimit, "rate-limit", defaultRateLimit, "Maximum requests per second to each upstream host (0 for no limit)")
+	connectTimeout := fs.Int("connect-timeout", int(defaultConnectTimeout/time.Second), "Seconds to wait when connecting to an upstream API")
+	readTimeout := fs.Int("read-timeout", int(defaultReadTimeout/time.Second), "Seconds to wait for each upstream response, including its body")
+	fs.IntVar(&config.MaxRetries, "retries", defaultMaxRetries, "Retries for upstream requests that fail with a network error, 429 or 5xx")
+	fs.StringVar(&config.RecordDir, "record", "", "Directory to save every raw upstream response to")
+	fs.StringVar(&config.ReplayDir, "replay", "", "Directory of responses saved with -record to serve instead of calling upstream APIs")
+	locationTimeout := fs.Int("location-timeout", 0, "Seconds allowed to fetch each location (0 for no limit)")
+	runTimeout := fs.Int("run-timeout", 0, "Seconds allowed for each run over all locations (0 for no limit)")
+	shutdownTimeout := fs.Int("shutdown-timeout", int(defaultShutdownTimeout/time.Second), "Seconds the current run may keep going after SIGINT or SIGTERM before it is cancelled")
+	fs.StringVar(&config.OWMBaseURL, "owm-base-url", defaultOWMBaseURL, "Base URL of the OpenWeatherMap API")
+	fs.StringVar(&config.NWSBaseURL, "nws-base-url", defaultNWSBaseURL, "Base URL of the National Weather Service API")
+	fs.StringVar(&config.OpenMeteoBaseURL, "open-meteo-base-url", defaultOpenMeteoBaseURL, "Base URL of the Open-Meteo forecast API")
+	fs.StringVar(&config.OpenMeteoGeocodingBaseURL, "open-meteo-geocoding-base-url", defaultOpenMeteoGeocodingBaseURL, "Base URL of the Open-Meteo geocoding API")
+	fs.StringVar(&config.MetNoBaseURL, "met-no-base-url", defaultMetNoBaseURL, "Base URL of the MET Norway API")
+	fs.StringVar(&config.OpenAIBaseURL, "openai-base-url", defaultOpenAIBaseURL, "Base URL of the OpenAI API")
+	fs.StringVar(&config.UserAgent, "user-agent", "", "User-Agent sent to the weather APIs, with contact details, e.g. \"weathercli/1.0 ops@example.com\"")
+	allowHostsStr := fs.String("allow-hosts", strings.Join(defaultAllowedHosts, ","), "Comma-separated hosts upstream requests may go to, including their subdomains")
+	fs.BoolVar(&config.AllowHTTP, "allow-http", false, "Allow plain HTTP upstream URLs, e.g. for a local stand-in server")
+	fs.BoolVar(&config.ZipSearch, "zip-search", false, "Look up ZIP codes missing from the offline gazetteer with the Open-Meteo postal code search")
+	fs.StringVar(&config.CacheDir, "cache-dir", "", "Directory for the persistent geocoding cache (disabled if empty)")
+	cacheTTL := fs.Int("cache-ttl", int(defaultCacheTTL/time.Second), "Lifetime of cached geocoding results in seconds")
 
 	// Parse flags
-	flag.Parse()
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
 
 	// Process ZIP codes
 	if *zipCodesStr != "" {
 		config.ZipCodes = strings.Split(*zipCodesStr, ",")
-	} else {
-		// Check for positional argument
-		if flag.NArg() > 0 {
-			config.ZipCodes = []string{flag.Arg(0)}
-		}
 	}
 
-	// Set output format
+	// Process other locations. As before -location, positional arguments are
+	// only taken as locations when -zip-codes isn't given.
+	config.Args = fs.Args()
+	config.Locations = locations
+	if *zipCodesStr == "" {
+		config.Locations = append(config.Locations, fs.Args()...)
+	}
+
+	// Read the SASL password from the environment after parsing, so that it
+	// isn't shown as the flag's default in the usage message
+	if config.KafkaSASLPassword == "" {
+		config.KafkaSASLPassword = os.Getenv("KAFKA_SASL_PASSWORD")
+	}
+
+	// Process provider chain
+	if *providersStr != "" {
+		config.Providers = strings.Split(*providersStr, ",")
+	}
+
+	// Process upstream host allowlist
+	if *allowHostsStr != "" {
+		config.AllowedHosts = strings.Split(*allowHostsStr, ",")
+	}
+
+	// Set outputs
 	config.OutputFormat = OutputFormat(*format)
+	config.Sinks = sinks
 
 	// Set interval
 	if *interval > 0 {
 		config.Interval = time.Duration(*interval) * time.Second
 	}
 
-	// Log API choice
-	if config.APIKey == "" {
-		log.Println("No OpenWeatherMap API key provided. Using National Weather Service API as fallback.")
+	// Set breaker cooldown
+	config.BreakerCooldown = time.Duration(*breakerCooldown) * time.Second
+
+	// Set upstream timeouts
+	config.ConnectTimeout = time.Duration(*connectTimeout) * time.Second
+	config.ReadTimeout = time.Duration(*readTimeout) * time.Second
+
+	// Set fetch deadlines
+	config.LocationTimeout = time.Duration(*locationTimeout) * time.Second
+	config.RunTimeout = time.Duration(*runTimeout) * time.Second
+	config.ShutdownTimeout = time.Duration(*shutdownTimeout) * time.Second
+
+	// Process CSV column selection
+	if *csvColumnsStr != "" {
+		config.CSVColumns = strings.Split(*csvColumnsStr, ",")
 	}
 
-	return config
+	// Set output file rotation
+	config.RotateInterval = time.Duration(*rotateInterval) * time.Second
+
+	// Set Kafka batching delay
+	config.KafkaLinger = time.Duration(*kafkaLinger) * time.Millisecond
+
+	// Set cache lifetime
+	config.CacheTTL = time.Duration(*cacheTTL) * time.Second
+
+	return config, nil
 }
 
 // ValidateConfig validates the configuration
 func ValidateConfig(config *Config) error {
 	// API key is now optional - if not provided, we'll use the National Weather Service API
 
-	if len(config.ZipCodes) == 0 {
-		return fmt.Errorf("at least one ZIP code is required")
+	locations, err := config.ParsedLocations()
+	if err != nil {
+		return err
+	}
+	if len(locations) == 0 {
+		return fmt.Errorf("at least one location is required")
+	}
+
+	specs, err := config.SinkSpecs()
+	if err != nil {
+		return err
+	}
+	if _, err := NewSinks(config); err != nil {
+		return err
 	}
 
-	for _, zip := range config.ZipCodes {
-		if !isValidZip(zip) {
-			return fmt.Errorf("invalid ZIP code format: %s", zip)
+	if hasKafkaSink(specs) {
+		if _, err := kafkaOptions(config); err != nil {
+			return err
+		}
+		if config.KafkaLinger < 0 || config.KafkaBatchBytes < 0 {
+			return fmt.Errorf("kafka linger and batch size must not be negative")
 		}
 	}
 
-	switch config.OutputFormat {
-	case FormatJSON, FormatCSV, FormatText, FormatKafka:
-		// Valid format
-	default:
-		return fmt.Errorf("invalid output format: %s", config.OutputFormat)
+	if err := validateCSVOptions(config.csvOptions()); err != nil {
+		return err
+	}
+	if err := validateCompression(config.OutputCompression); err != nil {
+		return err
+	}
+	if config.RotateSize < 0 || config.RotateInterval < 0 {
+		return fmt.Errorf("rotation size and interval must not be negative")
+	}
+	if err := validateParquetOptions(config.parquetOptions()); err != nil {
+		return err
 	}
 
-	if config.OutputFormat == FormatKafka && config.KafkaBroker == "" {
-		return fmt.Errorf("kafka broker is required when using kafka output format")
+	if _, err := config.Units(); err != nil {
+		return err
+	}
+
+	if config.Hourly < 0 {
+		return fmt.Errorf("hourly forecast hours must not be negative")
+	}
+	if config.Concurrency < 0 {
+		return fmt.Errorf("concurrency must not be negative")
+	}
+	if config.RateLimit < 0 {
+		return fmt.Errorf("rate limit must not be negative")
+	}
+	if config.MaxRetries < 0 {
+		return fmt.Errorf("retries must not be negative")
+	}
+	if config.RecordDir != "" && config.ReplayDir != "" {
+		return fmt.Errorf("-record and -replay cannot be used together")
+	}
+	if config.LocationTimeout < 0 || config.RunTimeout < 0 || config.ShutdownTimeout < 0 {
+		return fmt.Errorf("timeouts must not be negative")
+	}
+
+	if err := validateEndpoints(config); err != nil {
+		return err
+	}
+
+	provider, err := NewProvider(config)
+	if err != nil {
+		return err
+	}
+	if chain, ok := provider.(*providerChain); ok {
+		for _, name := range chain.skipped {
+			log.Printf("Skipping provider %s: no OpenWeatherMap API key", name)
+		}
+		for _, p := range chain.providers {
+			if p.Name() == "met-no" && config.UserAgent == "" {
+				log.Printf("MET Norway requires contact details in the User-Agent; set -user-agent")
+			}
+		}
 	}
 
 	return nil
 }
 
 // ProcessLocations processes all locations in the configuration
-func ProcessLocations(config *Config) {
-	var weatherDataList []WeatherData
+// Locations are fetched by up to config.Concurrency workers, and records are
+// written to the sinks in input order as soon as the locations before them are
+// done. Cancelling the context stops the run, and whatever was collected
+// before then is still written.
+func ProcessLocations(ctx context.Context, config *Config) {
+	locations, err := config.ParsedLocations()
+	if err != nil {
+		log.Printf("Error parsing locations: %v", err)
+		return
+	}
 
-	for _, zip := range config.ZipCodes {
-		if config.Verbose {
-			log.Printf("Processing ZIP code: %s", zip)
+	sink, err := NewSinks(config)
+	if err != nil {
+		log.Printf("Error creating outputs: %v", err)
+		return
+	}
+	run, err := newRunInfo(time.Now())
+	if err != nil {
+		log.Printf("Error starting run: %v", err)
+		return
+	}
+	if err := sink.Open(ctx, run); err != nil {
+		log.Printf("Error opening outputs: %v", err)
+	}
+	defer func() {
+		if err := sink.Close(); err != nil {
+			log.Printf("Error closing outputs: %v", err)
 		}
+	}()
 
-		// Get weather data
-		weatherData, err := GetLocationWeather(zip, config)
-		if err != nil {
-			log.Printf("Error processing %s: %v", zip, err)
-			continue
+	if config.RunTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.RunTimeout)
+		defer cancel()
+	}
+
+	workers := config.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(locations) {
+		workers = len(locations)
+	}
+
+	// Results are stored by input index and released to the sinks in order:
+	// next is the first location that isn't done yet
+	results := make([]*WeatherData, len(locations))
+	done := make([]bool, len(locations))
+	next := 0
+	var outputMu sync.Mutex
+	release := func() {
+		for next < len(locations) && done[next] {
+			if result := results[next]; result != nil {
+				if err := sink.Write(ctx, *result); err != nil {
+					log.Printf("Error writing output for %s: %v", result.LocationID, err)
+				}
+			}
+			next++
 		}
+	}
+	finish := func(i int, result *WeatherData) {
+		outputMu.Lock()
+		defer outputMu.Unlock()
+		results[i] = result
+		done[i] = true
+		release()
+	}
 
-		weatherDataList = append(weatherDataList, weatherData)
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				// Drain remaining work once the run is cancelled
+				if ctx.Err() != nil {
+					finish(i, nil)
+					continue
+				}
+
+				loc := locations[i]
+				if config.Verbose {
+					log.Printf("Processing location: %s", loc)
+				}
+
+				// Get weather data
+				weatherData, err := getLocationWeatherWithTimeout(ctx, loc, config)
+				if err != nil {
+					log.Printf("Error processing %s: %v", loc, err)
+					finish(i, nil)
+					continue
+				}
+
+				finish(i, &weatherData)
+			}
+		}()
+	}
 
-		// Output data immediately if not collecting for batch output
-		if config.OutputFormat != FormatJSON && config.OutputFormat != FormatCSV {
-			OutputWeatherData(weatherData, config)
+feed:
+	for i := range locations {
+		select {
+		case indexes <- i:
+		case <-ctx.Done():
+			break feed
 		}
 	}
+	close(indexes)
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		log.Printf("Run stopped before all locations were fetched: %v", err)
+	}
+
+	// Locations that were never started don't hold back the ones after them
+	for i := next; i < len(locations); i++ {
+		done[i] = true
+	}
+	release()
+
+	if err := sink.Flush(ctx); err != nil {
+		log.Printf("Error flushing outputs: %v", err)
+	}
+}
 
-	// Batch output for formats that make sense in batch
-	if len(weatherDataList) > 0 && (config.OutputFormat == FormatJSON || config.OutputFormat == FormatCSV) {
-		OutputWeatherDataBatch(weatherDataList, config)
+// getLocationWeatherWithTimeout applies the per-location deadline
+func getLocationWeatherWithTimeout(ctx context.Context, loc Location, config *Config) (WeatherData, error) {
+	if config.LocationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.LocationTimeout)
+		defer cancel()
 	}
+	return GetLocationWeather(ctx, loc, config)
 }
 
 // GetLocationWeather retrieves and processes weather data for a location
-func GetLocationWeather(zip string, config *Config) (WeatherData, error) {
+func GetLocationWeather(ctx context.Context, loc Location, config *Config) (WeatherData, error) {
 	var weatherData WeatherData
 
 	// Get coordinates
-	lat, lon, city, err := getCoordinates(zip, config.APIKey)
+	geocoder, err := NewGeocoder(config)
+	if err != nil {
+		return weatherData, err
+	}
+
+	lat, lon, city, err := geocoder.Geocode(ctx, loc)
 	if err != nil {
 		return weatherData, fmt.Errorf("failed to get coordinates: %w", err)
 	}
 
-	// Get weather
-	weather, err := getWeather(lat, lon, config.APIKey)
+	// Get weather from the selected provider
+	provider, err := NewProvider(config)
+	if err != nil {
+		return weatherData, err
+	}
+
+	weather, err := provider.GetWeather(ctx, lat, lon)
 	if err != nil {
 		return weatherData, fmt.Errorf("failed to get weather: %w", err)
 	}
 
+	if config.Verbose {
+		log.Printf("Weather for %s provided by %s", loc, weather.Provider)
+	}
+
+	// Convert from the providers' metric units to the configured units
+	spec, err := config.Units()
+	if err != nil {
+		return weatherData, err
+	}
+	applyUnits(&weather, spec)
+
 	// Process data into standardized format
 	weatherData = WeatherData{
-		LocationID:   zip,
+		LocationID:   loc.ID(),
 		LocationName: city,
+		Latitude:     lat,
+		Longitude:    lon,
 		Timestamp:    time.Now(),
 		Temperature:  weather.Current.Temp,
 		FeelsLike:    weather.Current.FeelsLike,
 		Humidity:     weather.Current.Humidity,
 		WindSpeed:    weather.Current.WindSpeed,
-		IsMetric:     config.IsMetric,
+		Pressure:     weather.Current.Pressure,
+		Source:       weather.Provider,
+		IsMetric:     spec.IsMetric(),
+		Units:        spec,
+		Station:      weather.Station,
+	}
+	if !weather.ObservedAt.IsZero() {
+		weatherData.ObservedAt = &weather.ObservedAt
 	}
 
 	if len(weather.Current.Weather) > 0 {
 		weatherData.Condition = weather.Current.Weather[0].Description
 	}
 
+	// Today's range comes from the first forecast day
+	if len(weather.Daily) > 0 {
+		weatherData.TempMin = weather.Daily[0].Temp.Min
+		weatherData.TempMax = weather.Daily[0].Temp.Max
+	}
+
 	// Process forecast data
 	forecastDays := len(weather.Daily)
-	if forecastDays > 7 {
-		forecastDays = 7
+	if forecastDays > maxForecastDays+1 {
+		forecastDays = maxForecastDays + 1
 	}
 
 	weatherData.ForecastDays = forecastDays - 1 // Excluding today
 	weatherData.Forecast = make([]struct {
-		Date      time.Time `json:"date"`
-		TempMin   float64   `json:"temp_min"`
-		TempMax   float64   `json:"temp_max"`
-		Condition string    `json:"condition"`
+		Date          time.Time `json:"date"`
+		TempMin       *float64  `json:"temp_min"`
+		TempMax       *float64  `json:"temp_max"`
+		Condition     string    `json:"condition"`
+		Precipitation *float64  `json:"precipitation"`
 	}, forecastDays-1)
 
 	for i := 1; i < forecastDays; i++ {
 		day := weather.Daily[i]
 		weatherData.Forecast[i-1] = struct {
-			Date      time.Time `json:"date"`
-			TempMin   float64   `json:"temp_min"`
-			TempMax   float64   `json:"temp_max"`
-			Condition string    `json:"condition"`
+			Date          time.Time `json:"date"`
+			TempMin       *float64  `json:"temp_min"`
+			TempMax       *float64  `json:"temp_max"`
+			Condition     string    `json:"condition"`
+			Precipitation *float64  `json:"precipitation"`
 		}{
-			Date:      time.Unix(day.Dt, 0),
-			TempMin:   day.Temp.Min,
-			TempMax:   day.Temp.Max,
-			Condition: day.Weather[0].Description,
+			Date:          time.Unix(day.Dt, 0),
+			TempMin:       day.Temp.Min,
+			TempMax:       day.Temp.Max,
+			Condition:     day.Weather[0].Description,
+			Precipitation: sumOptional(day.Rain, day.Snow),
 		}
 	}
 
-	// Generate summary if needed for specific output formats
-	if config.OutputFormat == FormatText {
-		forecastText := buildForecastText(city, zip, weather)
+	// Most severe alerts first
+	if len(weather.Alerts) > 0 {
+		weatherData.Alerts = weather.Alerts
+		sortAlerts(weatherData.Alerts)
+	}
+
+	// Process the hourly forecast, starting with the current hour
+	if config.Hourly > 0 {
+		weatherData.Hourly = hourlyForecast(weather.Hourly, weatherData.Timestamp, config.Hourly)
+	}
+
+	// Generate the summary only for outputs that write it
+	if config.needsSummary() {
+		forecastText := buildForecastText(city, loc.Label(), weather, spec)
 		if config.Verbose {
 			log.Println("Generating AI summary")
 		}
-		weatherData.Summary = summarizeForecast(forecastText)
+		weatherData.Summary = summarizeForecast(ctx, forecastText)
 	}
 
 	return weatherData, nil
 }
 
-// OutputWeatherData outputs a single weather data record
-func OutputWeatherData(data WeatherData, config *Config) {
-	switch config.OutputFormat {
-	case FormatText:
-		OutputTextFormat(data, config)
-	case FormatJSON:
-		// Single JSON records handled in batch
-	case FormatCSV:
-		// CSV records handled in batch
-	case FormatKafka:
-		SendToKafka(data, config)
-	}
-}
+// hourlyForecast converts up to hours entries of a provider's hourly forecast,
+// skipping hours that are already over
+func hourlyForecast(hourly []HourlyWeather, now time.Time, hours int) []HourlyForecast {
+	var forecast []HourlyForecast
+	for _, hour := range hourly {
+		if len(forecast) == hours {
+			break
+		}
+		start := time.Unix(hour.Dt, 0)
+		if !start.Add(time.Hour).After(now) {
+			continue
+		}
 
-// OutputWeatherDataBatch outputs a batch of weather data records
-func OutputWeatherDataBatch(dataList []WeatherData, config *Config) {
-	switch config.OutputFormat {
-	case FormatJSON:
-		OutputJSONFormat(dataList, config)
-	case FormatCSV:
-		OutputCSVFormat(dataList, config)
+		entry := HourlyForecast{
+			Time:        start,
+			Temperature: hour.Temp,
+			WindSpeed:   hour.WindSpeed,
+		}
+		if hour.Pop != nil {
+			entry.PrecipProbability = ptr(int(math.Round(*hour.Pop * 100)))
+		}
+		if len(hour.Weather) > 0 {
+			entry.Condition = hour.Weather[0].Description
+		}
+		forecast = append(forecast, entry)
 	}
+	return forecast
 }
 
-// OutputTextFormat outputs weather data in human-readable text format
-func OutputTextFormat(data WeatherData, config *Config) {
-	unit := "°F"
-	windUnit := "mph"
-	if config.IsMetric {
-		unit = "°C"
-		windUnit = "m/s"
+// OutputTextFormat writes weather data in human-readable text format
+func OutputTextFormat(output io.Writer, data WeatherData) error {
+	var b strings.Builder
+
+	unit := data.Units.Temperature.Symbol()
+	windUnit := data.Units.Wind.Symbol()
+	pressureUnit := data.Units.Pressure.Symbol()
+	precipUnit := data.Units.Precipitation.Symbol()
+
+	fmt.Fprintf(&b, "\n📍 Weather for %s (%s)\n", data.LocationName, locationLabel(data.LocationID))
+	fmt.Fprintln(&b, "-----------------------------------")
+	for _, alert := range data.Alerts {
+		fmt.Fprintf(&b, "⚠️  ALERT: %s\n", describeAlert(alert))
+		if alert.Headline != "" {
+			fmt.Fprintf(&b, "   %s\n", alert.Headline)
+		}
+	}
+	humidity := "n/a"
+	if data.Humidity != nil {
+		humidity = fmt.Sprintf("%d%%", *data.Humidity)
+	}
+	fmt.Fprintf(&b, "Now: %s, feels like %s, %s\n",
+		describeOptional("%.1f", data.Temperature, unit), describeOptional("%.1f", data.FeelsLike, unit), data.Condition)
+	fmt.Fprintf(&b, "Humidity: %s, Wind: %s\n", humidity, describeOptional("%.1f", data.WindSpeed, " "+windUnit))
+	if data.Pressure != nil {
+		fmt.Fprintf(&b, "Pressure: %.2f %s\n", *data.Pressure, pressureUnit)
+	}
+	if data.Source != "" {
+		fmt.Fprintf(&b, "Source: %s\n", data.Source)
+	}
+	if data.Station != "" && data.ObservedAt != nil {
+		fmt.Fprintf(&b, "Station: %s, observed %s\n", data.Station, data.ObservedAt.Local().Format("Mon Jan 2 15:04 MST"))
 	}
 
-	fmt.Printf("\n📍 Weather for %s (ZIP: %s)\n", data.LocationName, data.LocationID)
-	fmt.Println("-----------------------------------")
-	fmt.Printf("Now: %.1f%s, feels like %.1f%s, %s\n",
-		data.Temperature, unit, data.FeelsLike, unit, data.Condition)
-	fmt.Printf("Humidity: %d%%, Wind: %.1f %s\n", data.Humidity, data.WindSpeed, windUnit)
-
-	fmt.Println("\n📆 Forecast:")
+	fmt.Fprintln(&b, "\n📆 Forecast:")
 	for _, day := range data.Forecast {
 		date := day.Date.Format("Mon Jan 2")
-		fmt.Printf("%s: Min %.1f%s, Max %.1f%s, %s\n",
-			date, day.TempMin, unit, day.TempMax, unit, day.Condition)
+		fmt.Fprintf(&b, "%s: Min %s, Max %s, %s",
+			date, describeOptional("%.1f", day.TempMin, unit), describeOptional("%.1f", day.TempMax, unit), day.Condition)
+		if day.Precipitation != nil && *day.Precipitation > 0 {
+			fmt.Fprintf(&b, ", Precip %.2f %s", *day.Precipitation, precipUnit)
+		}
+		fmt.Fprintln(&b)
 	}
 
-	if data.Summary != "" {
-		fmt.Println("\n📝 AI-Generated Forecast:")
-		fmt.Println(data.Summary)
+	if len(data.Hourly) > 0 {
+		fmt.Fprintln(&b, "\n⏰ Hourly:")
+		for _, hour := range data.Hourly {
+			precip := "n/a"
+			if hour.PrecipProbability != nil {
+				precip = fmt.Sprintf("%d%%", *hour.PrecipProbability)
+			}
+			fmt.Fprintf(&b, "%s: %s, Precip %s, Wind %s, %s\n",
+				hour.Time.Local().Format("Mon 15:04"), describeOptional("%.1f", hour.Temperature, unit),
+				precip, describeOptional("%.1f", hour.WindSpeed, " "+windUnit), hour.Condition)
+		}
 	}
-}
-
-// OutputJSONFormat outputs weather data in JSON format
-func OutputJSONFormat(dataList []WeatherData, config *Config) {
-	var output *os.File
-	var err error
 
-	if config.OutputPath == "" {
-		output = os.Stdout
-	} else {
-		output, err = os.Create(config.OutputPath)
-		if err != nil {
-			log.Printf("Error creating output file: %v", err)
-			return
-		}
-		defer output.Close()
+	if data.Summary != "" {
+		fmt.Fprintln(&b, "\n📝 AI-Generated Forecast:")
+		fmt.Fprintln(&b, data.Summary)
 	}
 
+	_, err := io.WriteString(output, b.String())
+	return err
+}
+
+// OutputJSONFormat writes weather data in JSON format: a single record as an
+// object, several as an array
+func OutputJSONFormat(output io.Writer, dataList []WeatherData) error {
 	encoder := json.NewEncoder(output)
 	encoder.SetIndent("", "  ")
 
 	if len(dataList) == 1 {
 		// Single record
 		if err := encoder.Encode(dataList[0]); err != nil {
-			log.Printf("Error encoding JSON: %v", err)
-		}
-	} else {
-		// Multiple records
-		if err := encoder.Encode(dataList); err != nil {
-			log.Printf("Error encoding JSON: %v", err)
+			return fmt.Errorf("error encoding JSON: %w", err)
 		}
+		return nil
 	}
-}
 
-// OutputCSVFormat outputs weather data in CSV format
-func OutputCSVFormat(dataList []WeatherData, config *Config) {
-	var output *os.File
-	var err error
+	// Multiple records
+	if err := encoder.Encode(dataList); err != nil {
+		return fmt.Errorf("error encoding JSON: %w", err)
+	}
+	return nil
+}
 
-	if config.OutputPath == "" {
-		output = os.Stdout
-	} else {
-		output, err = os.Create(config.OutputPath)
-		if err != nil {
-			log.Printf("Error creating output file: %v", err)
-			return
+// hasHourly reports whether any record has an hourly forecast
+func hasHourly(dataList []WeatherData) bool {
+	for _, data := range dataList {
+		if len(data.Hourly) > 0 {
+			return true
 		}
-		defer output.Close()
 	}
+	return false
+}
+
+// hourlyOutputPath returns the file the hourly CSV is written to, e.g.
+// weather-hourly.csv for weather.csv
+func hourlyOutputPath(path string) string {
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "-hourly" + ext
+}
 
+// writeHourlyCSV writes the hourly forecasts with one row per location and
+// hour
+func writeHourlyCSV(output io.Writer, dataList []WeatherData) error {
 	writer := csv.NewWriter(output)
-	defer writer.Flush()
 
-	// Write header
+	spec := dataList[0].Units
 	header := []string{
-		"location_id", "location_name", "timestamp", "temperature",
-		"feels_like", "humidity", "wind_speed", "condition", "is_metric",
+		"location_id", "location_name", "time",
+		"temperature_" + spec.Temperature.Suffix(),
+		"precip_probability",
+		"wind_speed_" + spec.Wind.Suffix(),
+		"condition",
 	}
 	if err := writer.Write(header); err != nil {
-		log.Printf("Error writing CSV header: %v", err)
-		return
+		return err
 	}
 
-	// Write data rows
 	for _, data := range dataList {
-		row := []string{
-			data.LocationID,
-			data.LocationName,
-			data.Timestamp.Format(time.RFC3339),
-			fmt.Sprintf("%.1f", data.Temperature),
-			fmt.Sprintf("%.1f", data.FeelsLike),
-			fmt.Sprintf("%d", data.Humidity),
-			fmt.Sprintf("%.1f", data.WindSpeed),
-			data.Condition,
-			fmt.Sprintf("%t", data.IsMetric),
-		}
-
-		if err := writer.Write(row); err != nil {
-			log.Printf("Error writing CSV row: %v", err)
+		for _, hour := range data.Hourly {
+			row := []string{
+				data.LocationID,
+				data.LocationName,
+				hour.Time.Format(time.RFC3339),
+				formatOptional("%.1f", hour.Temperature),
+				formatOptionalInt(hour.PrecipProbability),
+				formatOptional("%.1f", hour.WindSpeed),
+				hour.Condition,
+			}
+			if err := writer.Write(row); err != nil {
+				return err
+			}
 		}
 	}
-}
-
-// SendToKafka sends weather data to Kafka
-func SendToKafka(data WeatherData, config *Config) {
-	// Note: This is a placeholder for Kafka integration
-	// In a real implementation, you would:
-	// 1. Import the Kafka client library
-	// 2. Establish a connection to the Kafka broker
-	// 3. Serialize the weather data to JSON
-	// 4. Send the data to the specified topic
-
-	if config.Verbose {
-		log.Printf("Would send data for %s to Kafka topic %s at broker %s",
-			data.LocationID, config.KafkaTopic, config.KafkaBroker)
-	}
 
-	// For now, just indicate what would happen
-	log.Printf("Kafka integration not implemented - data for %s would be sent to %s",
-		data.LocationID, config.KafkaTopic)
+	writer.Flush()
+	return writer.Error()
 }
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"weathercli/units"
+)
+
+// slowProvider returns a fixed forecast after a delay that depends on the
+// latitude, so concurrent requests finish out of order
+type slowProvider struct{}
+
+func (p *slowProvider) Name() string {
+	return "slow"
+}
+
+func (p *slowProvider) GetWeather(ctx context.Context, lat, lon float64) (WeatherResponse, error) {
+	time.Sleep(time.Duration(int(lat)%7) * time.Millisecond)
+
+	weather := WeatherResponse{}
+	weather.Current.Temp = ptr(lat)
+	weather.Current.Weather = []struct {
+		Description string `json:"description"`
+	}{{Description: "clear sky"}}
+	weather.Daily = make([]struct {
+		Dt   int64 `json:"dt"`
+		Temp struct {
+			Min *float64 `json:"min"`
+			Max *float64 `json:"max"`
+		} `json:"temp"`
+		Weather []struct {
+			Description string `json:"description"`
+		} `json:"weather"`
+		Rain *float64 `json:"rain"`
+		Snow *float64 `json:"snow"`
+	}, 2)
+	for i := range weather.Daily {
+		weather.Daily[i].Weather = weather.Current.Weather
+	}
+	return weather, nil
+}
+
+func TestParsedLocationsPositionalArgs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"80202"}, []string{"80202"}},
+		{[]string{"-location", "icao:KDEN", "80202"}, []string{"icao:KDEN", "80202"}},
+		// Positional arguments are ignored when -zip-codes is given
+		{[]string{"-zip-codes", "90210,10001", "80202"}, []string{"90210", "10001"}},
+		{[]string{"-zip-codes", "90210", "-location", "icao:KDEN", "80202"}, []string{"90210", "icao:KDEN"}},
+	}
+
+	for _, test := range tests {
+		config, err := parseConfigArgs(test.args, io.Discard)
+		if err != nil {
+			t.Fatalf("Expected no error for %v, got: %v", test.args, err)
+		}
+		locations, err := config.ParsedLocations()
+		if err != nil {
+			t.Fatalf("Expected no error for %v, got: %v", test.args, err)
+		}
+		var ids []string
+		for _, loc := range locations {
+			ids = append(ids, loc.ID())
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(test.expected) {
+			t.Errorf("Expected locations %v for %v, got %v", test.expected, test.args, ids)
+		}
+	}
+}
+
+func TestProcessLocationsPreservesOrder(t *testing.T) {
+	RegisterProvider("slow", func(config *Config) (WeatherProvider, error) {
+		return &slowProvider{}, nil
+	})
+	defer delete(providerRegistry, "slow")
+
+	var locations []string
+	for lat := 10; lat < 40; lat++ {
+		locations = append(locations, fmt.Sprintf("coords:%d,0", lat))
+	}
+
+	output := filepath.Join(t.TempDir(), "weather.json")
+	config := &Config{
+		Provider:     "slow",
+		Locations:    locations,
+		OutputFormat: FormatJSON,
+		OutputPath:   output,
+		IsMetric:     true,
+		Concurrency:  8,
+	}
+	ProcessLocations(context.Background(), config)
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Expected output file, got: %v", err)
+	}
+
+	var records []WeatherData
+	if err := json.Unmarshal(data, &records); err != nil {
+		t.Fatalf("Expected JSON array, got: %v", err)
+	}
+	if len(records) != len(locations) {
+		t.Fatalf("Expected %d records, got %d", len(locations), len(records))
+	}
+	for i, record := range records {
+		if record.Temperature == nil || *record.Temperature != float64(10+i) {
+			t.Errorf("Expected record %d to be for latitude %d, got %v", i, 10+i, record.Temperature)
+		}
+	}
+}
+
+func TestProcessLocationsLocationTimeout(t *testing.T) {
+	RegisterProvider("blocking", func(config *Config) (WeatherProvider, error) {
+		return &blockingProvider{name: "blocking"}, nil
+	})
+	defer delete(providerRegistry, "blocking")
+	resetProviderHealth()
+	defer resetProviderHealth()
+
+	output := filepath.Join(t.TempDir(), "weather.json")
+	config := &Config{
+		Provider:        "blocking",
+		Locations:       []string{"coords:1,0", "coords:2,0", "coords:3,0"},
+		OutputFormat:    FormatJSON,
+		OutputPath:      output,
+		Concurrency:     3,
+		LocationTimeout: 20 * time.Millisecond,
+	}
+
+	start := time.Now()
+	ProcessLocations(context.Background(), config)
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected locations to time out quickly, took %v", elapsed)
+	}
+
+	// Nothing was collected, so nothing is written
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("Expected no output file, got: %v", err)
+	}
+}
+
+func TestProcessLocationsCancelled(t *testing.T) {
+	RegisterProvider("slow", func(config *Config) (WeatherProvider, error) {
+		return &slowProvider{}, nil
+	})
+	defer delete(providerRegistry, "slow")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	output := filepath.Join(t.TempDir(), "weather.json")
+	config := &Config{
+		Provider:     "slow",
+		Locations:    []string{"coords:1,0", "coords:2,0"},
+		OutputFormat: FormatJSON,
+		OutputPath:   output,
+	}
+	ProcessLocations(ctx, config)
+
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("Expected no output after cancellation, got: %v", err)
+	}
+}
+
+func TestOutputMissingMeasurements(t *testing.T) {
+	data := WeatherData{
+		LocationID:  "coords:39.7000,-104.9000",
+		Timestamp:   time.Now(),
+		Temperature: ptr(21.5),
+		WindSpeed:   ptr(0.0),
+		Units:       units.Metric(),
+	}
+	dir := t.TempDir()
+
+	// Missing measurements are null in JSON, while a real zero is kept
+	output := filepath.Join(dir, "weather.json")
+	if err := writeJSONFile(output, compressionNone, []WeatherData{data}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	raw, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Expected output file, got: %v", err)
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal(raw, &record); err != nil {
+		t.Fatalf("Expected JSON object, got: %v", err)
+	}
+	for _, field := range []string{"feels_like", "humidity", "pressure", "temp_min", "temp_max"} {
+		if value, ok := record[field]; !ok || value != nil {
+			t.Errorf("Expected %s to be null, got %v", field, value)
+		}
+	}
+	if record["temperature"] != 21.5 || record["wind_speed"] != 0.0 {
+		t.Errorf("Expected temperature 21.5 and wind speed 0, got %v and %v", record["temperature"], record["wind_speed"])
+	}
+
+	// and empty cells in CSV
+	output = filepath.Join(dir, "weather.csv")
+	if err := writeCSVFile(output, compressionNone, csvOptions{}, []WeatherData{data}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	file, err := os.Open(output)
+	if err != nil {
+		t.Fatalf("Expected output file, got: %v", err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil || len(rows) != 2 {
+		t.Fatalf("Expected a header and one row, got %d rows and %v", len(rows), err)
+	}
+	cells := make(map[string]string)
+	for i, column := range rows[0] {
+		cells[column] = rows[1][i]
+	}
+	if cells["temperature_c"] != "21.5" || cells["wind_speed_ms"] != "0.0" {
+		t.Errorf("Expected temperature 21.5 and wind speed 0.0, got %q and %q", cells["temperature_c"], cells["wind_speed_ms"])
+	}
+	for _, column := range []string{"feels_like_c", "humidity", "pressure_hpa"} {
+		if cells[column] != "" {
+			t.Errorf("Expected %s to be empty, got %q", column, cells[column])
+		}
+	}
+}
+
+func TestHourlyForecast(t *testing.T) {
+	now := time.Date(2026, 10, 16, 14, 30, 0, 0, time.UTC)
+	var hourly []HourlyWeather
+	for hour := 13; hour < 20; hour++ {
+		hourly = append(hourly, HourlyWeather{
+			Dt:   time.Date(2026, 10, 16, hour, 0, 0, 0, time.UTC).Unix(),
+			Temp: ptr(float64(hour)),
+			Pop:  ptr(0.125),
+		})
+	}
+
+	// The hour that is already over is skipped, the current one is kept
+	forecast := hourlyForecast(hourly, now, 3)
+	if len(forecast) != 3 {
+		t.Fatalf("Expected 3 hours, got %d", len(forecast))
+	}
+	if forecast[0].Time.UTC().Hour() != 14 || *forecast[0].Temperature != 14 || *forecast[0].PrecipProbability != 13 {
+		t.Errorf("Expected 14°C at 14:00 with a 13%% chance of rain, got %+v", forecast[0])
+	}
+
+	// Writing hourly data to CSV adds a long-format table next to the output
+	data := WeatherData{LocationID: "coords:39.7000,-104.9000", Units: units.Metric(), Hourly: forecast}
+	output := filepath.Join(t.TempDir(), "weather.csv")
+	if err := writeCSVFile(output, compressionNone, csvOptions{}, []WeatherData{data}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	file, err := os.Open(hourlyOutputPath(output))
+	if err != nil {
+		t.Fatalf("Expected hourly output file, got: %v", err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil || len(rows) != 4 {
+		t.Fatalf("Expected a header and 3 rows, got %d rows and %v", len(rows), err)
+	}
+	if start, err := time.Parse(time.RFC3339, rows[1][2]); err != nil || !start.Equal(forecast[0].Time) {
+		t.Errorf("Expected the first row to start at %v, got %s", forecast[0].Time, rows[1][2])
+	}
+	if rows[0][3] != "temperature_c" || rows[3][3] != "16.0" || rows[1][5] != "" {
+		t.Errorf("Unexpected hourly rows: %v", rows)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// WeatherProvider is a source of current conditions and daily forecasts
+type WeatherProvider interface {
+	// Name returns the identifier used to select the provider
+	Name() string
+
+	// GetWeather fetches current conditions and the daily forecast for a
+	// location, and the hourly forecast if the configuration asks for it,
+	// aborting if the context is cancelled
+	GetWeather(ctx context.Context, lat, lon float64) (WeatherResponse, error)
+}
+
+// ProviderFactory builds a WeatherProvider from the application configuration
+type ProviderFactory func(config *Config) (WeatherProvider, error)
+
+// providerRegistry maps provider names to their factories
+var providerRegistry = map[string]ProviderFactory{}
+
+// RegisterProvider makes a weather provider available under the given name
+func RegisterProvider(name string, factory ProviderFactory) {
+	providerRegistry[strings.ToLower(name)] = factory
+}
+
+// ProviderNames returns the names of all registered providers in sorted order
+func ProviderNames() []string {
+	names := make([]string, 0, len(providerRegistry))
+	for name := range providerRegistry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// errNoAPIKey reports that OpenWeatherMap was selected without an API key
+var errNoAPIKey = errors.New("the owm provider requires an OpenWeatherMap API key")
+
+// NewProvider builds the provider chain selected in the configuration. A
+// single provider is returned as a chain of one so that it still benefits from
+// health tracking. In a chain of several, owm is skipped without an API key so
+// that the other providers still work.
+func NewProvider(config *Config) (WeatherProvider, error) {
+	names := config.Providers
+	if len(names) == 0 {
+		name := config.Provider
+		if name == "" {
+			name = defaultProviderName(config)
+		}
+		names = []string{name}
+	}
+
+	chain := &providerChain{
+		threshold: config.BreakerThreshold,
+		cooldown:  config.BreakerCooldown,
+		verbose:   config.Verbose,
+	}
+	for _, name := range names {
+		provider, err := newNamedProvider(name, config)
+		if errors.Is(err, errNoAPIKey) && len(names) > 1 {
+			chain.skipped = append(chain.skipped, strings.ToLower(strings.TrimSpace(name)))
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		chain.providers = append(chain.providers, provider)
+	}
+	if len(chain.providers) == 0 {
+		return nil, errNoAPIKey
+	}
+	return chain, nil
+}
+
+// newNamedProvider builds a single registered provider by name
+func newNamedProvider(name string, config *Config) (WeatherProvider, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	factory, ok := providerRegistry[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown weather provider: %s (available: %s)", name, strings.Join(ProviderNames(), ", "))
+	}
+	return factory(config)
+}
+
+// defaultProviderName picks OpenWeatherMap when an API key is configured and
+// falls back to the National Weather Service otherwise
+func defaultProviderName(config *Config) string {
+	if config.APIKey == "" {
+		return "nws"
+	}
+	return "owm"
+}
+
+func init() {
+	RegisterProvider("owm", newOWMProvider)
+	RegisterProvider("nws", newNWSProvider)
+}
+
+// owmProvider fetches weather from the OpenWeatherMap One Call API
+type owmProvider struct {
+	apiKey string
+	hourly bool
+}
+
+func newOWMProvider(config *Config) (WeatherProvider, error) {
+	if config.APIKey == "" {
+		return nil, errNoAPIKey
+	}
+	return &owmProvider{apiKey: config.APIKey, hourly: config.Hourly > 0}, nil
+}
+
+func (p *owmProvider) Name() string {
+	return "owm"
+}
+
+func (p *owmProvider) GetWeather(ctx context.Context, lat, lon float64) (WeatherResponse, error) {
+	return getOWMWeather(ctx, lat, lon, p.apiKey, p.hourly)
+}
+
+// nwsProvider fetches weather from the National Weather Service API
+type nwsProvider struct {
+	cache  *Cache
+	hourly bool
+}
+
+func newNWSProvider(config *Config) (WeatherProvider, error) {
+	cache, err := configCache(config)
+	if err != nil {
+		return nil, err
+	}
+	return &nwsProvider{cache: cache, hourly: config.Hourly > 0}, nil
+}
+
+func (p *nwsProvider) Name() string {
+	return "nws"
+}
+
+func (p *nwsProvider) GetWeather(ctx context.Context, lat, lon float64) (WeatherResponse, error) {
+	return getNWSWeather(ctx, lat, lon, p.cache, p.hourly)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNewProvider(t *testing.T) {
+	// Without an API key the NWS provider is used by default
+	provider, err := NewProvider(&Config{})
+	if err != nil {
+		t.Fatalf("Expected no error for default provider, got: %v", err)
+	}
+	if provider.Name() != "nws" {
+		t.Errorf("Expected nws provider without API key, got %s", provider.Name())
+	}
+
+	// With an API key OpenWeatherMap is used by default
+	provider, err = NewProvider(&Config{APIKey: "test-key"})
+	if err != nil {
+		t.Fatalf("Expected no error for default provider, got: %v", err)
+	}
+	if provider.Name() != "owm" {
+		t.Errorf("Expected owm provider with API key, got %s", provider.Name())
+	}
+
+	// Explicit selection overrides the default
+	provider, err = NewProvider(&Config{APIKey: "test-key", Provider: "NWS"})
+	if err != nil {
+		t.Fatalf("Expected no error for explicit provider, got: %v", err)
+	}
+	if provider.Name() != "nws" {
+		t.Errorf("Expected nws provider when selected, got %s", provider.Name())
+	}
+
+	// OpenWeatherMap requires an API key
+	if _, err := NewProvider(&Config{Provider: "owm"}); err == nil {
+		t.Error("Expected error for owm provider without API key, got nil")
+	}
+
+	// In a chain, owm is skipped without an API key
+	provider, err = NewProvider(&Config{Providers: []string{"owm", "open-meteo"}})
+	if err != nil {
+		t.Fatalf("Expected owm to be skipped, got: %v", err)
+	}
+	if provider.Name() != "open-meteo" {
+		t.Errorf("Expected a chain of open-meteo, got %s", provider.Name())
+	}
+	if _, err := NewProvider(&Config{Providers: []string{"owm", "owm"}}); err == nil {
+		t.Error("Expected error for a chain with no usable provider, got nil")
+	}
+
+	// Unknown providers are rejected
+	if _, err := NewProvider(&Config{Provider: "unknown"}); err == nil {
+		t.Error("Expected error for unknown provider, got nil")
+	}
+}
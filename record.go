@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// redactedParams are query parameters holding credentials. They are left out
+// of recordings and of the keys recordings are stored under, so a recording
+// made with one API key replays with another.
+var redactedParams = []string{"appid", "apikey", "api_key", "key", "token"}
+
+// recordedResponse is an upstream response saved by -record
+type recordedResponse struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+	RecordedAt time.Time   `json:"recorded_at"`
+}
+
+// redactURL returns a URL with credential query parameters removed
+func redactURL(u *url.URL) string {
+	redacted := *u
+	query := redacted.Query()
+	for _, param := range redactedParams {
+		query.Del(param)
+	}
+	redacted.RawQuery = query.Encode()
+	return redacted.String()
+}
+
+// recordingPath returns the file a request's response is recorded in. The name
+// starts with the host so recordings are easy to browse, followed by a hash of
+// the method, redacted URL and request body.
+func recordingPath(dir string, req *http.Request, body []byte) string {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "%s %s\n", req.Method, redactURL(req.URL))
+	hash.Write(body)
+	return filepath.Join(dir, fmt.Sprintf("%s-%s.json", req.URL.Hostname(), hex.EncodeToString(hash.Sum(nil))[:16]))
+}
+
+// readRequestBody reads a request body and replaces it so the request can
+// still be sent
+func readRequestBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading request body: %w", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// recordingTransport is an http.RoundTripper that saves every response it
+// receives to a directory. When a request is retried the last response wins.
+type recordingTransport struct {
+	base http.RoundTripper
+	dir  string
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	recording := recordedResponse{
+		Method:     req.Method,
+		URL:        redactURL(req.URL),
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       string(respBody),
+		RecordedAt: time.Now().UTC(),
+	}
+
+	// A failure to record shouldn't fail the request itself
+	if err := saveRecording(recordingPath(t.dir, req, body), recording); err != nil {
+		log.Printf("Error recording response: %v", err)
+	}
+	return resp, nil
+}
+
+// saveRecording writes a recording atomically
+func saveRecording(path string, recording recordedResponse) error {
+	data, err := json.MarshalIndent(recording, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error encoding recording: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("error creating record directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("error writing recording: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing recording: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing recording: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("error writing recording: %w", err)
+	}
+	return nil
+}
+
+// replayTransport is an http.RoundTripper that serves responses saved by
+// recordingTransport without touching the network
+type replayTransport struct {
+	dir string
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	body, err := readRequestBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	path := recordingPath(t.dir, req, body)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no recorded response for %s %s in %s", req.Method, redactURL(req.URL), t.dir)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading recording: %w", err)
+	}
+
+	var recording recordedResponse
+	if err := json.Unmarshal(data, &recording); err != nil {
+		return nil, fmt.Errorf("error decoding recording %s: %w", path, err)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recording.StatusCode, http.StatusText(recording.StatusCode)),
+		StatusCode:    recording.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recording.Header,
+		Body:          io.NopCloser(strings.NewReader(recording.Body)),
+		ContentLength: int64(len(recording.Body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"lat": ` + r.URL.Query().Get("lat") + `}`)) //nolint
+	}))
+
+	dir := t.TempDir()
+	recorder := newHTTPClient(httpSettings{ConnectTimeout: time.Second, ReadTimeout: time.Second, RecordDir: dir})
+	resp, err := recorder.Get(server.URL + "/data?lat=39.7&appid=secret")
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	resp.Body.Close()
+	server.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 1 {
+		t.Fatalf("Expected one recording, got %d", len(files))
+	}
+	data, _ := os.ReadFile(files[0])
+	if strings.Contains(string(data), "secret") {
+		t.Error("Expected the API key to be redacted from the recording")
+	}
+
+	// Replay works offline and doesn't depend on the API key
+	replayer := newHTTPClient(httpSettings{ReplayDir: dir})
+	resp, err = replayer.Get(server.URL + "/data?lat=39.7&appid=other")
+	if err != nil {
+		t.Fatalf("Expected recorded response, got: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != `{"lat": 39.7}` {
+		t.Errorf("Expected recorded 200 response, got %d %q", resp.StatusCode, body)
+	}
+	if resp.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected recorded headers, got %v", resp.Header)
+	}
+
+	// Requests that weren't recorded fail
+	if _, err := replayer.Get(server.URL + "/data?lat=40.0"); err == nil {
+		t.Error("Expected an error for a request that wasn't recorded")
+	}
+}
+
+func TestRecordingPathIncludesBody(t *testing.T) {
+	first, _ := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", nil)
+	second, _ := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", nil)
+
+	if recordingPath("dir", first, []byte(`{"a": 1}`)) == recordingPath("dir", second, []byte(`{"a": 2}`)) {
+		t.Error("Expected requests with different bodies to be recorded separately")
+	}
+	if !strings.HasPrefix(filepath.Base(recordingPath("dir", first, nil)), "api.openai.com-") {
+		t.Errorf("Expected recording name to start with the host, got %s", recordingPath("dir", first, nil))
+	}
+}
+
+func TestNWSWeatherReplay(t *testing.T) {
+	defer func(client *http.Client) { httpClient = client }(httpClient)
+	httpClient = newHTTPClient(httpSettings{ReplayDir: filepath.Join("testdata", "replay", "nws")})
+
+	now := time.Date(2024, 6, 1, 18, 30, 0, 0, time.UTC)
+	weather, err := fetchNWSWeather(context.Background(), 39.7392, -104.9903, nil, false, now)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// The nearest station has a recent observation; its heat index is null
+	if weather.Station != "KDEN" || !weather.ObservedAt.Equal(time.Date(2024, 6, 1, 17, 53, 0, 0, time.UTC)) {
+		t.Errorf("Expected the KDEN observation from 17:53, got %s from %v", weather.Station, weather.ObservedAt)
+	}
+	if *weather.Current.Temp != 26.1 || *weather.Current.FeelsLike != 26.1 || *weather.Current.Humidity != 23 {
+		t.Errorf("Expected 26.1°C feeling like 26.1°C at 23%%, got %v, %v and %v", *weather.Current.Temp, *weather.Current.FeelsLike, *weather.Current.Humidity)
+	}
+	if math.Abs(*weather.Current.WindSpeed-4.11) > 0.01 || math.Abs(*weather.Current.Pressure-1013.2) > 0.01 {
+		t.Errorf("Expected 4.11 m/s and 1013.2 hPa, got %v and %v", *weather.Current.WindSpeed, *weather.Current.Pressure)
+	}
+
+	// Day and night periods are grouped into calendar days
+	expected := []struct {
+		min, max    float64
+		description string
+	}{
+		{14.44, 28.89, "Sunny"},
+		{15.56, 31.11, "Mostly Sunny"},
+		{12.78, 26.11, "Chance Showers And Thunderstorms"},
+	}
+	if len(weather.Daily) != len(expected) {
+		t.Fatalf("Expected %d days, got %d", len(expected), len(weather.Daily))
+	}
+	for i, day := range weather.Daily {
+		if math.Abs(*day.Temp.Min-expected[i].min) > 0.01 || math.Abs(*day.Temp.Max-expected[i].max) > 0.01 {
+			t.Errorf("Day %d: expected %.2f to %.2f, got %.2f to %.2f", i, expected[i].min, expected[i].max, *day.Temp.Min, *day.Temp.Max)
+		}
+		if day.Weather[0].Description != expected[i].description {
+			t.Errorf("Day %d: expected %q, got %q", i, expected[i].description, day.Weather[0].Description)
+		}
+	}
+
+	// Active alerts come with their grading and times
+	if len(weather.Alerts) != 2 {
+		t.Fatalf("Expected 2 alerts, got %d", len(weather.Alerts))
+	}
+	heat := weather.Alerts[0]
+	if heat.Event != "Heat Advisory" || heat.Severity != "Moderate" || heat.Urgency != "Expected" {
+		t.Errorf("Expected a moderate, expected heat advisory, got %+v", heat)
+	}
+	if heat.Onset == nil || !heat.Onset.Equal(time.Date(2024, 6, 1, 18, 0, 0, 0, time.UTC)) || heat.Expires == nil {
+		t.Errorf("Expected the heat advisory to start at 18:00 UTC and expire, got %v and %v", heat.Onset, heat.Expires)
+	}
+	if weather.Alerts[1].Onset != nil {
+		t.Errorf("Expected a null onset to be missing, got %v", weather.Alerts[1].Onset)
+	}
+}
+
+func TestNWSWeatherReplayStationFailover(t *testing.T) {
+	defer func(client *http.Client) { httpClient = client }(httpClient)
+	httpClient = newHTTPClient(httpSettings{ReplayDir: filepath.Join("testdata", "replay", "nws")})
+
+	// KDEN's observation is too old by now, so the next station is used
+	now := time.Date(2024, 6, 1, 20, 5, 0, 0, time.UTC)
+	weather, err := fetchNWSWeather(context.Background(), 39.7392, -104.9903, nil, false, now)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if weather.Station != "KBKF" || *weather.Current.Temp != 27.8 {
+		t.Errorf("Expected 27.8°C from KBKF, got %v°C from %s", *weather.Current.Temp, weather.Station)
+	}
+	if weather.Current.WindSpeed != nil {
+		t.Errorf("Expected KBKF's null wind speed to be missing, got %v", *weather.Current.WindSpeed)
+	}
+
+	// No station has a recent observation
+	if _, err := fetchNWSWeather(context.Background(), 39.7392, -104.9903, nil, false, now.Add(24*time.Hour)); err == nil {
+		t.Error("Expected an error when every observation is stale")
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"compress/gzip"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression of finished output files
+const (
+	compressionNone = "none"
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+)
+
+// compressionExtensions maps each compression to the extension added to the
+// files it produces
+var compressionExtensions = map[string]string{
+	"":              "",
+	compressionNone: "",
+	compressionGzip: ".gz",
+	compressionZstd: ".zst",
+}
+
+// RunInfo identifies a run of the pipeline. File output paths can be
+// templates using its start time and ID.
+type RunInfo struct {
+	ID    string
+	Start time.Time
+}
+
+// newRunInfo starts a run, with an ID that sorts by start time and a random
+// suffix so that runs started in the same second don't share output files
+func newRunInfo(start time.Time) (RunInfo, error) {
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return RunInfo{}, fmt.Errorf("error generating run ID: %w", err)
+	}
+	return RunInfo{
+		ID:    start.UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix),
+		Start: start,
+	}, nil
+}
+
+// pathFields are the fields available in templated output paths. The date
+// and hour are those of the run's start in UTC.
+type pathFields struct {
+	Date  string
+	Hour  string
+	RunID string
+}
+
+// renderPath expands a templated output path, such as
+// /data/weather/dt={{.Date}}/hour={{.Hour}}/part-{{.RunID}}.ndjson, for a run
+func renderPath(path string, run RunInfo) (string, error) {
+	if !strings.Contains(path, "{{") {
+		return path, nil
+	}
+
+	tmpl, err := template.New("path").Parse(path)
+	if err != nil {
+		return "", fmt.Errorf("invalid output path template: %w", err)
+	}
+	fields := pathFields{
+		Date:  run.Start.UTC().Format("2006-01-02"),
+		Hour:  run.Start.UTC().Format("15"),
+		RunID: run.ID,
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, fields); err != nil {
+		return "", fmt.Errorf("invalid output path template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// checkPathTemplate reports errors in a templated output path up front
+func checkPathTemplate(path string) error {
+	_, err := renderPath(path, RunInfo{ID: "check", Start: time.Now()})
+	return err
+}
+
+// validateCompression checks an output compression setting
+func validateCompression(compression string) error {
+	if _, ok := compressionExtensions[compression]; !ok {
+		return fmt.Errorf("invalid output compression: %s (use none, gzip or zstd)", compression)
+	}
+	return nil
+}
+
+// compressedPath returns the name of an output file once compressed, e.g.
+// weather.csv.gz
+func compressedPath(path, compression string) string {
+	ext := compressionExtensions[compression]
+	if strings.HasSuffix(path, ext) {
+		return path
+	}
+	return path + ext
+}
+
+// outputFile is an output being written. Close makes it visible at its path;
+// Abort discards it.
+type outputFile interface {
+	io.Writer
+	Close() error
+	Abort()
+}
+
+// createOutput starts an output file at path, replacing any file there when
+// closed, or returns stdout
+func createOutput(path, compression string) (outputFile, error) {
+	if isStdout(path) {
+		return stdoutWriter{os.Stdout}, nil
+	}
+	return createAtomicFile(path, compression)
+}
+
+// stdoutWriter is stdout as an output that is left open when closed
+type stdoutWriter struct {
+	io.Writer
+}
+
+func (stdoutWriter) Close() error {
+	return nil
+}
+
+func (stdoutWriter) Abort() {}
+
+// atomicFile is an output file written under a temporary name in its
+// directory and renamed into place when finished, so readers never see it
+// half-written. Its content is compressed on the way if configured.
+type atomicFile struct {
+	path       string
+	file       *os.File
+	compressor io.WriteCloser
+
+	// Bytes written, before compression
+	size int64
+}
+
+// createAtomicFile starts an output file, creating its directory if needed
+func createAtomicFile(path, compression string) (*atomicFile, error) {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating output directory: %w", err)
+	}
+	file, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("error creating output file: %w", err)
+	}
+	f := &atomicFile{path: compressedPath(path, compression), file: file}
+
+	// Temporary files are private; the finished file is for downstream readers
+	err = file.Chmod(0o644)
+	if err == nil {
+		switch compression {
+		case compressionGzip:
+			f.compressor = gzip.NewWriter(file)
+		case compressionZstd:
+			f.compressor, err = zstd.NewWriter(file)
+		}
+	}
+	if err != nil {
+		f.Abort()
+		return nil, fmt.Errorf("error creating output file: %w", err)
+	}
+	return f, nil
+}
+
+func (f *atomicFile) Write(p []byte) (int, error) {
+	var n int
+	var err error
+	if f.compressor != nil {
+		n, err = f.compressor.Write(p)
+	} else {
+		n, err = f.file.Write(p)
+	}
+	f.size += int64(n)
+	return n, err
+}
+
+// Close finishes the file, replacing any file already at its path
+func (f *atomicFile) Close() error {
+	return f.finish(true)
+}
+
+// finish completes the file and renames it into place. Unless replace is set,
+// a file already at the path is kept and this one is numbered instead, e.g.
+// part-1.ndjson next to part.ndjson.
+func (f *atomicFile) finish(replace bool) error {
+	if f.compressor != nil {
+		if err := f.compressor.Close(); err != nil {
+			f.Abort()
+			return fmt.Errorf("error compressing output file: %w", err)
+		}
+	}
+	if err := f.file.Sync(); err != nil {
+		f.Abort()
+		return fmt.Errorf("error writing output file: %w", err)
+	}
+	if err := f.file.Close(); err != nil {
+		os.Remove(f.file.Name())
+		return fmt.Errorf("error writing output file: %w", err)
+	}
+
+	if !replace {
+		f.path = unusedPath(f.path)
+	}
+	if err := os.Rename(f.file.Name(), f.path); err != nil {
+		os.Remove(f.file.Name())
+		return fmt.Errorf("error moving output file into place: %w", err)
+	}
+	return nil
+}
+
+// Abort discards the file
+func (f *atomicFile) Abort() {
+	f.file.Close()
+	os.Remove(f.file.Name())
+}
+
+// unusedPath returns path, or if a file is already there, the first free
+// numbered name, e.g. part-1.ndjson.gz for part.ndjson.gz
+func unusedPath(path string) string {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return path
+	}
+
+	dir, base := filepath.Split(path)
+	name, ext := base, ""
+	trimmed := strings.TrimPrefix(base, ".")
+	if i := strings.Index(trimmed, "."); i >= 0 {
+		i += len(base) - len(trimmed)
+		name, ext = base[:i], base[i:]
+	}
+	for n := 1; ; n++ {
+		candidate := filepath.Join(dir, fmt.Sprintf("%s-%d%s", name, n, ext))
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// rotatingFile is an output file kept open across runs. The current part is
+// finished, and the next write starts a new one, when the path changes or the
+// part reaches the configured size or age.
+type rotatingFile struct {
+	mu          sync.Mutex
+	compression string
+	maxSize     int64
+	maxAge      time.Duration
+
+	path    string
+	current *atomicFile
+	opened  time.Time
+}
+
+// rotatingFiles holds the rotating outputs by path template, so that they
+// stay open between runs
+var rotatingFiles = struct {
+	sync.Mutex
+	files map[string]*rotatingFile
+}{files: map[string]*rotatingFile{}}
+
+// sharedRotatingFile returns the rotating output for a path template,
+// creating it with the configured rotation and compression
+func sharedRotatingFile(target string, config *Config) *rotatingFile {
+	rotatingFiles.Lock()
+	defer rotatingFiles.Unlock()
+
+	file, ok := rotatingFiles.files[target]
+	if !ok {
+		file = &rotatingFile{
+			compression: config.OutputCompression,
+			maxSize:     config.RotateSize,
+			maxAge:      config.RotateInterval,
+		}
+		rotatingFiles.files[target] = file
+	}
+	return file
+}
+
+// CloseRotatingFiles finishes every rotating output file, so that new
+// settings apply to the next part. It must only be called between runs.
+func CloseRotatingFiles() error {
+	rotatingFiles.Lock()
+	defer rotatingFiles.Unlock()
+
+	targets := make([]string, 0, len(rotatingFiles.files))
+	for target := range rotatingFiles.files {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+
+	var errs []error
+	for _, target := range targets {
+		if err := rotatingFiles.files[target].Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(rotatingFiles.files, target)
+	}
+	return errors.Join(errs...)
+}
+
+// SetPath directs writes to path, finishing the current part if it was
+// written elsewhere or is old enough
+func (f *rotatingFile) SetPath(path string, now time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var err error
+	if f.current != nil && (path != f.path || f.due(0, now)) {
+		err = f.finish()
+	}
+	f.path = path
+	return err
+}
+
+// Write writes p to the current part, first finishing it if p would take it
+// over the size limit or it is old enough
+func (f *rotatingFile) Write(p []byte, now time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.current != nil && f.due(len(p), now) {
+		if err := f.finish(); err != nil {
+			return err
+		}
+	}
+	if f.current == nil {
+		current, err := createAtomicFile(f.path, f.compression)
+		if err != nil {
+			return err
+		}
+		f.current = current
+		f.opened = now
+	}
+
+	_, err := f.current.Write(p)
+	return err
+}
+
+// due reports whether the current part should be finished before writing n
+// more bytes. A part always takes at least one write, however large.
+func (f *rotatingFile) due(n int, now time.Time) bool {
+	if f.maxSize > 0 && f.current.size > 0 && f.current.size+int64(n) > f.maxSize {
+		return true
+	}
+	return f.maxAge > 0 && now.Sub(f.opened) >= f.maxAge
+}
+
+// Close finishes the current part
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.finish()
+}
+
+func (f *rotatingFile) finish() error {
+	if f.current == nil {
+		return nil
+	}
+	err := f.current.finish(false)
+	f.current = nil
+	return err
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// listFiles returns the names of the files under dir, relative to it
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var names []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			rel, _ := filepath.Rel(dir, path)
+			names = append(names, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("Expected to list %s, got: %v", dir, err)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestRenderPath(t *testing.T) {
+	run := RunInfo{ID: "20261016T113000Z-0a1b2c3d", Start: time.Date(2026, 10, 16, 11, 30, 0, 0, time.UTC)}
+
+	path, err := renderPath("/data/weather/dt={{.Date}}/hour={{.Hour}}/part-{{.RunID}}.ndjson", run)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if path != "/data/weather/dt=2026-10-16/hour=11/part-20261016T113000Z-0a1b2c3d.ndjson" {
+		t.Errorf("Unexpected path %s", path)
+	}
+
+	if path, err := renderPath("/data/weather.json", run); err != nil || path != "/data/weather.json" {
+		t.Errorf("Expected a plain path to be kept, got %s and %v", path, err)
+	}
+	for _, path := range []string{"/data/{{.Minute}}.json", "/data/{{.Date}.json"} {
+		if err := checkPathTemplate(path); err == nil {
+			t.Errorf("Expected %s to be rejected", path)
+		}
+	}
+}
+
+func TestAtomicFileCompression(t *testing.T) {
+	dir := t.TempDir()
+
+	readers := map[string]func(io.Reader) (io.Reader, error){
+		compressionGzip: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		compressionZstd: func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+	for compression, newReader := range readers {
+		path := filepath.Join(dir, "weather.csv")
+		f, err := createAtomicFile(path, compression)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if _, err := f.Write([]byte("location_id\nzip:90210\n")); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		// Nothing is visible under the final name until the file is finished
+		if _, err := os.Stat(compressedPath(path, compression)); !os.IsNotExist(err) {
+			t.Errorf("Expected no %s output before closing, got: %v", compression, err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+
+		file, err := os.Open(path + compressionExtensions[compression])
+		if err != nil {
+			t.Fatalf("Expected %s output file, got: %v", compression, err)
+		}
+		reader, err := newReader(file)
+		if err != nil {
+			t.Fatalf("Expected %s stream, got: %v", compression, err)
+		}
+		content, err := io.ReadAll(reader)
+		file.Close()
+		if err != nil || string(content) != "location_id\nzip:90210\n" {
+			t.Errorf("Expected the written rows back from %s, got %q and %v", compression, content, err)
+		}
+	}
+
+	// An aborted file leaves nothing behind
+	f, err := createAtomicFile(filepath.Join(dir, "aborted.json"), compressionNone)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	f.Abort()
+
+	expected := []string{"weather.csv.gz", "weather.csv.zst"}
+	if files := listFiles(t, dir); strings.Join(files, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2026, 10, 16, 11, 0, 0, 0, time.UTC)
+	file := &rotatingFile{maxSize: 10, maxAge: time.Hour}
+
+	write := func(line string, at time.Duration) {
+		t.Helper()
+		if err := file.Write([]byte(line), start.Add(at)); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+
+	if err := file.SetPath(filepath.Join(dir, "part.ndjson"), start); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	write("aaaa\n", 0)
+	write("bbbb\n", time.Minute)
+
+	// The third line would take the part over 10 bytes
+	write("cccc\n", 2*time.Minute)
+
+	// A part older than an hour is finished when the next run starts
+	if err := file.SetPath(filepath.Join(dir, "part.ndjson"), start.Add(2*time.Hour)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	// as is the current part when the path changes
+	write("dddd\n", 2*time.Hour)
+	if err := file.SetPath(filepath.Join(dir, "next", "part.ndjson"), start.Add(2*time.Hour)); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	write("eeee\n", 2*time.Hour)
+	if err := file.Close(); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	expected := map[string]string{
+		"part.ndjson":      "aaaa\nbbbb\n",
+		"part-1.ndjson":    "cccc\n",
+		"part-2.ndjson":    "dddd\n",
+		"next/part.ndjson": "eeee\n",
+	}
+	files := listFiles(t, dir)
+	if len(files) != len(expected) {
+		t.Fatalf("Expected %d files, got %v", len(expected), files)
+	}
+	for name, content := range expected {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(data) != content {
+			t.Errorf("Expected %s to hold %q, got %q and %v", name, content, data, err)
+		}
+	}
+}
+
+func TestNDJSONSinkPerRunFiles(t *testing.T) {
+	dir := t.TempDir()
+	defer CloseRotatingFiles() //nolint
+
+	target := filepath.Join(dir, "dt={{.Date}}", "part-{{.RunID}}.ndjson")
+	config := &Config{OutputCompression: compressionGzip}
+
+	runs := []RunInfo{
+		{ID: "first", Start: time.Date(2026, 10, 16, 23, 0, 0, 0, time.UTC)},
+		{ID: "second", Start: time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, run := range runs {
+		sink, err := newNDJSONSink(target, config)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if err := sink.Open(context.Background(), run); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if err := sink.Write(context.Background(), WeatherData{LocationID: "zip:90210"}); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if err := sink.Flush(context.Background()); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+
+	// Each run's file is finished at the end of the run
+	expected := []string{"dt=2026-10-16/part-first.ndjson.gz", "dt=2026-10-17/part-second.ndjson.gz"}
+	if files := listFiles(t, dir); strings.Join(files, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+}
+
+func TestNDJSONSinkCompressedWithoutLimits(t *testing.T) {
+	dir := t.TempDir()
+	defer CloseRotatingFiles() //nolint
+
+	// Compression alone finishes a part per run, rather than keeping every
+	// run in a hidden temporary file until exit
+	target := filepath.Join(dir, "weather.ndjson")
+	config := &Config{OutputCompression: compressionGzip}
+	for _, id := range []string{"first", "second"} {
+		sink, err := newNDJSONSink(target, config)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if err := sink.Open(context.Background(), RunInfo{ID: id, Start: time.Now()}); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if err := sink.Write(context.Background(), WeatherData{LocationID: "zip:90210"}); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if err := sink.Flush(context.Background()); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+
+	expected := []string{"weather-1.ndjson.gz", "weather.ndjson.gz"}
+	if files := listFiles(t, dir); strings.Join(files, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected %v, got %v", expected, files)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	// Default time the current run may keep going after SIGINT or SIGTERM
+	defaultShutdownTimeout = 10 * time.Second
+
+	// Exit code when every run completed, including a run in progress when a
+	// shutdown signal arrived. A run cut short by a signal exits with 128 plus
+	// the signal number, as a shell would report it.
+	exitOK = 0
+)
+
+// Run processes the configured locations once, or every config.Interval until
+// SIGINT or SIGTERM, and returns the process exit code. SIGHUP reloads the
+// configuration from args and the -config file between runs.
+func Run(config *Config, args []string) int {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	return runLoop(config, args, signals)
+}
+
+// runLoop runs the pipeline, reacting to signals delivered on the channel.
+// On the first shutdown signal no new runs are started and the current run
+// gets config.ShutdownTimeout to finish before its requests are cancelled; a
+// second signal cancels it immediately. Collected results are always written
+// before returning.
+func runLoop(config *Config, args []string, signals <-chan os.Signal) int {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Each run reports whether it finished without being cancelled
+	runDone := make(chan bool)
+	startRun := func(config *Config) {
+		go func() {
+			ProcessLocations(ctx, config)
+			runDone <- ctx.Err() == nil
+		}()
+	}
+
+	var ticker *time.Ticker
+	var ticks <-chan time.Time
+	if config.Interval > 0 {
+		ticker = time.NewTicker(config.Interval)
+		defer ticker.Stop()
+		ticks = ticker.C
+
+		log.Printf("Starting weather data pipeline. Fetching data every %v", config.Interval)
+	}
+
+	var stopSignal os.Signal
+	var shutdownTimer <-chan time.Time
+	cancelled := false
+	pendingReload := false
+
+	// Run once immediately
+	startRun(config)
+	running := true
+
+	for {
+		select {
+		case completed := <-runDone:
+			running = false
+			if !completed {
+				cancelled = true
+			}
+			if stopSignal != nil || config.Interval <= 0 {
+				return exitCode(stopSignal, cancelled)
+			}
+			if pendingReload {
+				pendingReload = false
+				config = reloadConfig(config, args, ticker)
+			}
+
+		case <-ticks:
+			if running {
+				if config.Verbose {
+					log.Println("Previous run still in progress, skipping this interval")
+				}
+				continue
+			}
+			startRun(config)
+			running = true
+
+		case <-shutdownTimer:
+			log.Println("Shutdown timeout reached, cancelling the current run")
+			cancel()
+
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				switch {
+				case stopSignal != nil:
+					// Shutting down anyway
+				case running:
+					log.Println("Received SIGHUP, reloading configuration after the current run")
+					pendingReload = true
+				default:
+					config = reloadConfig(config, args, ticker)
+				}
+				continue
+			}
+
+			if stopSignal != nil {
+				log.Printf("Received %v again, cancelling the current run", sig)
+				cancel()
+				continue
+			}
+
+			stopSignal = sig
+			if !running {
+				log.Printf("Received %v, stopping weather data pipeline", sig)
+				return exitCode(stopSignal, cancelled)
+			}
+			log.Printf("Received %v, finishing the current run (up to %v)", sig, config.ShutdownTimeout)
+			shutdownTimer = time.After(config.ShutdownTimeout)
+		}
+	}
+}
+
+// reloadConfig loads and validates the configuration again, keeping the
+// current one if the new one is invalid. It must only be called between runs.
+func reloadConfig(current *Config, args []string, ticker *time.Ticker) *Config {
+	if ticker == nil {
+		log.Println("Ignoring SIGHUP: configuration is only reloaded in interval mode")
+		return current
+	}
+
+	next, err := LoadConfig(args, io.Discard)
+	if err == nil {
+		err = ValidateConfig(next)
+	}
+	if err != nil {
+		log.Printf("Error reloading configuration, keeping the current one: %v", err)
+		return current
+	}
+
+	// Switching to a one-time run would stop the pipeline, which is what
+	// SIGTERM is for
+	if next.Interval <= 0 {
+		log.Printf("Reloaded configuration has no interval, keeping %v", current.Interval)
+		next.Interval = current.Interval
+	}
+	if next.Interval != current.Interval {
+		ticker.Reset(next.Interval)
+	}
+
+	if err := ConfigureKafka(next); err != nil {
+		log.Printf("Error reloading configuration, keeping the current one: %v", err)
+		return current
+	}
+	// Rotating files start a new part with the new settings
+	if err := CloseRotatingFiles(); err != nil {
+		log.Printf("Error finishing output files: %v", err)
+	}
+	ConfigureHTTP(next)
+	ConfigureEndpoints(next)
+	log.Printf("Configuration reloaded. Fetching data every %v", next.Interval)
+	return next
+}
+
+// exitCode returns the exit code after a shutdown
+func exitCode(sig os.Signal, cancelled bool) int {
+	if !cancelled {
+		return exitOK
+	}
+	if signum, ok := sig.(syscall.Signal); ok {
+		return 128 + int(signum)
+	}
+	return 1
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunLoopCancelsAfterShutdownTimeout(t *testing.T) {
+	RegisterProvider("blocking", func(config *Config) (WeatherProvider, error) {
+		return &blockingProvider{name: "blocking"}, nil
+	})
+	defer delete(providerRegistry, "blocking")
+	resetProviderHealth()
+	defer resetProviderHealth()
+
+	config := &Config{
+		Provider:        "blocking",
+		Locations:       []string{"coords:1,0"},
+		OutputFormat:    FormatJSON,
+		OutputPath:      filepath.Join(t.TempDir(), "weather.json"),
+		Interval:        time.Hour,
+		ShutdownTimeout: 10 * time.Millisecond,
+	}
+
+	signals := make(chan os.Signal, 1)
+	signals <- syscall.SIGTERM
+
+	done := make(chan int)
+	go func() { done <- runLoop(config, nil, signals) }()
+
+	select {
+	case code := <-done:
+		if code != 128+int(syscall.SIGTERM) {
+			t.Errorf("Expected exit code %d, got %d", 128+int(syscall.SIGTERM), code)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the run to be cancelled after the shutdown timeout")
+	}
+}
+
+func TestRunLoopFinishesCurrentRun(t *testing.T) {
+	RegisterProvider("slow", func(config *Config) (WeatherProvider, error) {
+		return &slowProvider{}, nil
+	})
+	defer delete(providerRegistry, "slow")
+
+	output := filepath.Join(t.TempDir(), "weather.json")
+	config := &Config{
+		Provider:        "slow",
+		Locations:       []string{"coords:1,0", "coords:2,0"},
+		OutputFormat:    FormatJSON,
+		OutputPath:      output,
+		Interval:        time.Hour,
+		ShutdownTimeout: time.Minute,
+	}
+
+	signals := make(chan os.Signal, 1)
+	signals <- syscall.SIGINT
+
+	if code := runLoop(config, nil, signals); code != exitOK {
+		t.Errorf("Expected exit code %d, got %d", exitOK, code)
+	}
+	if _, err := os.Stat(output); err != nil {
+		t.Errorf("Expected the current run to be written before exiting, got: %v", err)
+	}
+}
+
+func TestRunLoopSingleRun(t *testing.T) {
+	RegisterProvider("slow", func(config *Config) (WeatherProvider, error) {
+		return &slowProvider{}, nil
+	})
+	defer delete(providerRegistry, "slow")
+
+	config := &Config{
+		Provider:     "slow",
+		Locations:    []string{"coords:1,0"},
+		OutputFormat: FormatJSON,
+		OutputPath:   filepath.Join(t.TempDir(), "weather.json"),
+	}
+
+	if code := runLoop(config, nil, make(chan os.Signal)); code != exitOK {
+		t.Errorf("Expected exit code %d, got %d", exitOK, code)
+	}
+}
+
+func TestReloadConfig(t *testing.T) {
+	defer func(client *http.Client) { httpClient = client }(httpClient)
+	defer defaultHostLimiter.SetRate(0)
+	defer func(e Endpoints, p URLPolicy) { endpoints, urlPolicy = e, p }(endpoints, urlPolicy)
+
+	configFile := filepath.Join(t.TempDir(), "weathercli.conf")
+	if err := os.WriteFile(configFile, []byte("# Collection settings\ninterval=600\nzip-codes=90210\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	args := []string{"-config", configFile, "-metric"}
+	current, err := LoadConfig(args, io.Discard)
+	if err != nil {
+		t.Fatalf("Expected config to load, got: %v", err)
+	}
+	if current.Interval != 10*time.Minute || len(current.ZipCodes) != 1 || !current.IsMetric {
+		t.Fatalf("Expected config file and command line to be applied, got %+v", current)
+	}
+
+	ticker := time.NewTicker(current.Interval)
+	defer ticker.Stop()
+
+	// A valid change is applied
+	if err := os.WriteFile(configFile, []byte("interval=300\nzip-codes=90210,10001\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	next := reloadConfig(current, args, ticker)
+	if next.Interval != 5*time.Minute || len(next.ZipCodes) != 2 || !next.IsMetric {
+		t.Errorf("Expected reloaded config, got %+v", next)
+	}
+
+	// An invalid change keeps the current configuration
+	if err := os.WriteFile(configFile, []byte("zip-codes=abc\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if kept := reloadConfig(next, args, ticker); kept != next {
+		t.Errorf("Expected invalid config to be rejected, got %+v", kept)
+	}
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Sink is a destination for weather records. Each run opens its sinks, writes
+// every record in input order as soon as the locations before it are done,
+// then flushes and closes them.
+type Sink interface {
+	// Open prepares the sink for a run
+	Open(ctx context.Context, run RunInfo) error
+
+	// Write outputs a record, or buffers it if the format needs the whole run,
+	// like a JSON array
+	Write(ctx context.Context, data WeatherData) error
+
+	// Flush writes buffered records and waits until they are delivered
+	Flush(ctx context.Context) error
+
+	// Close releases what the sink holds for the run
+	Close() error
+}
+
+// SinkFactory builds a sink writing to a target, such as a file path or a
+// Kafka topic
+type SinkFactory func(target string, config *Config) (Sink, error)
+
+// sinkRegistry maps output formats to their sink factories
+var sinkRegistry = map[OutputFormat]SinkFactory{}
+
+// RegisterSink makes a sink available under the given output format
+func RegisterSink(format OutputFormat, factory SinkFactory) {
+	sinkRegistry[OutputFormat(strings.ToLower(string(format)))] = factory
+}
+
+// SinkFormats returns the names of all registered output formats in sorted
+// order
+func SinkFormats() []string {
+	names := make([]string, 0, len(sinkRegistry))
+	for format := range sinkRegistry {
+		names = append(names, string(format))
+	}
+	sort.Strings(names)
+	return names
+}
+
+func init() {
+	RegisterSink(FormatText, newTextSink)
+	RegisterSink(FormatJSON, newJSONSink)
+	RegisterSink(FormatNDJSON, newNDJSONSink)
+	RegisterSink(FormatCSV, newCSVSink)
+	RegisterSink(FormatKafka, newKafkaSink)
+	RegisterSink(FormatParquet, newParquetSink)
+}
+
+// SinkSpec selects an output as format:target. The target is a file path, or
+// - or empty for stdout; for kafka it is the topic.
+type SinkSpec struct {
+	Format OutputFormat
+	Target string
+}
+
+// String returns the spec as given with -sink
+func (s SinkSpec) String() string {
+	if s.Target == "" {
+		return string(s.Format)
+	}
+	return string(s.Format) + ":" + s.Target
+}
+
+// parseSinkSpec parses a -sink value such as json:/data/out.json
+func parseSinkSpec(value string) (SinkSpec, error) {
+	format, target, _ := strings.Cut(strings.TrimSpace(value), ":")
+	spec := SinkSpec{
+		Format: OutputFormat(strings.ToLower(format)),
+		Target: target,
+	}
+	if _, ok := sinkRegistry[spec.Format]; !ok {
+		return SinkSpec{}, fmt.Errorf("invalid sink %q: unknown format %s (available: %s)", value, format, strings.Join(SinkFormats(), ", "))
+	}
+	return spec, nil
+}
+
+// SinkSpecs returns the outputs given with -sink, or the single output
+// selected by -format and -output
+func (c *Config) SinkSpecs() ([]SinkSpec, error) {
+	if len(c.Sinks) == 0 {
+		if _, ok := sinkRegistry[c.OutputFormat]; !ok {
+			return nil, fmt.Errorf("invalid output format: %s", c.OutputFormat)
+		}
+		spec := SinkSpec{Format: c.OutputFormat, Target: c.OutputPath}
+		if c.OutputFormat == FormatKafka {
+			spec.Target = c.KafkaTopic
+		}
+		return []SinkSpec{spec}, nil
+	}
+
+	if c.OutputPath != "" {
+		return nil, fmt.Errorf("-output cannot be used with -sink; give the path in the sink, e.g. json:%s", c.OutputPath)
+	}
+
+	var specs []SinkSpec
+	paths := make(map[string]bool)
+	for _, value := range c.Sinks {
+		spec, err := parseSinkSpec(value)
+		if err != nil {
+			return nil, err
+		}
+
+		// Two sinks writing the same file would overwrite each other
+		if spec.Format != FormatKafka && !isStdout(spec.Target) {
+			if paths[spec.Target] {
+				return nil, fmt.Errorf("more than one sink writes to %s", spec.Target)
+			}
+			paths[spec.Target] = true
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// hasKafkaSink reports whether any of the outputs is Kafka
+func hasKafkaSink(specs []SinkSpec) bool {
+	for _, spec := range specs {
+		if spec.Format == FormatKafka {
+			return true
+		}
+	}
+	return false
+}
+
+// needsSummary reports whether any output writes the AI summary: text, CSV
+// unless its columns leave the summary out, and Parquet
+func (c *Config) needsSummary() bool {
+	specs, err := c.SinkSpecs()
+	if err != nil {
+		return false
+	}
+	for _, spec := range specs {
+		switch spec.Format {
+		case FormatText, FormatParquet:
+			return true
+		case FormatCSV:
+			if len(c.CSVColumns) == 0 {
+				return true
+			}
+			for _, column := range c.CSVColumns {
+				if strings.TrimSpace(column) == "summary" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// NewSinks builds the configured outputs as a single sink that fans records
+// out to all of them
+func NewSinks(config *Config) (Sink, error) {
+	specs, err := config.SinkSpecs()
+	if err != nil {
+		return nil, err
+	}
+
+	multi := &multiSink{}
+	for _, spec := range specs {
+		sink, err := sinkRegistry[spec.Format](spec.Target, config)
+		if err != nil {
+			return nil, fmt.Errorf("%s sink: %w", spec, err)
+		}
+		multi.sinks = append(multi.sinks, namedSink{name: spec.String(), Sink: sink})
+	}
+	return multi, nil
+}
+
+// CloseOutputs releases the outputs kept open between runs: the Kafka
+// producer and rotating files
+func CloseOutputs() {
+	CloseKafka()
+	if err := CloseRotatingFiles(); err != nil {
+		log.Printf("Error finishing output files: %v", err)
+	}
+}
+
+// namedSink is a sink with the spec it was built from, for error messages
+type namedSink struct {
+	name string
+	Sink
+}
+
+// multiSink fans records out to several sinks. A failing sink doesn't stop
+// the others; the errors of all of them are returned together.
+type multiSink struct {
+	sinks []namedSink
+}
+
+// Open opens every sink, dropping those that fail for the rest of the run
+func (m *multiSink) Open(ctx context.Context, run RunInfo) error {
+	var opened []namedSink
+	var errs []error
+	for _, sink := range m.sinks {
+		if err := sink.Open(ctx, run); err != nil {
+			errs = append(errs, fmt.Errorf("%s sink: %w", sink.name, err))
+			continue
+		}
+		opened = append(opened, sink)
+	}
+	m.sinks = opened
+	return errors.Join(errs...)
+}
+
+func (m *multiSink) Write(ctx context.Context, data WeatherData) error {
+	return m.each(func(sink Sink) error { return sink.Write(ctx, data) })
+}
+
+func (m *multiSink) Flush(ctx context.Context) error {
+	return m.each(func(sink Sink) error { return sink.Flush(ctx) })
+}
+
+func (m *multiSink) Close() error {
+	return m.each(Sink.Close)
+}
+
+// each calls f on every sink, collecting their errors
+func (m *multiSink) each(f func(Sink) error) error {
+	var errs []error
+	for _, sink := range m.sinks {
+		if err := f(sink.Sink); err != nil {
+			errs = append(errs, fmt.Errorf("%s sink: %w", sink.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isStdout reports whether a sink target means standard output
+func isStdout(path string) bool {
+	return path == "" || path == "-"
+}
+
+// textSink prints each record as it arrives in human-readable form
+type textSink struct {
+	target      string
+	compression string
+	output      outputFile
+}
+
+func newTextSink(target string, config *Config) (Sink, error) {
+	if err := checkPathTemplate(target); err != nil {
+		return nil, err
+	}
+	return &textSink{target: target, compression: config.OutputCompression}, nil
+}
+
+func (s *textSink) Open(ctx context.Context, run RunInfo) error {
+	path, err := renderPath(s.target, run)
+	if err != nil {
+		return err
+	}
+	output, err := createOutput(path, s.compression)
+	if err != nil {
+		return err
+	}
+	s.output = output
+	return nil
+}
+
+func (s *textSink) Write(ctx context.Context, data WeatherData) error {
+	return OutputTextFormat(s.output, data)
+}
+
+func (s *textSink) Flush(ctx context.Context) error {
+	return nil
+}
+
+func (s *textSink) Close() error {
+	return s.output.Close()
+}
+
+// batchSink collects a run's records for formats written all at once. Nothing
+// is written if the run collected no records.
+type batchSink struct {
+	target      string
+	compression string
+	path        string
+	records     []WeatherData
+	write       func(path, compression string, dataList []WeatherData) error
+}
+
+func newBatchSink(target string, config *Config, write func(path, compression string, dataList []WeatherData) error) (Sink, error) {
+	if err := checkPathTemplate(target); err != nil {
+		return nil, err
+	}
+	return &batchSink{target: target, compression: config.OutputCompression, write: write}, nil
+}
+
+func (s *batchSink) Open(ctx context.Context, run RunInfo) error {
+	path, err := renderPath(s.target, run)
+	if err != nil {
+		return err
+	}
+	s.path = path
+	s.records = nil
+	return nil
+}
+
+func (s *batchSink) Write(ctx context.Context, data WeatherData) error {
+	s.records = append(s.records, data)
+	return nil
+}
+
+// Flush writes the records even if the run was cancelled, so that whatever
+// was collected is kept
+func (s *batchSink) Flush(ctx context.Context) error {
+	if len(s.records) == 0 {
+		return nil
+	}
+	records := s.records
+	s.records = nil
+	return s.write(s.path, s.compression, records)
+}
+
+func (s *batchSink) Close() error {
+	return nil
+}
+
+// newJSONSink writes a run's records as one JSON document
+func newJSONSink(target string, config *Config) (Sink, error) {
+	return newBatchSink(target, config, writeJSONFile)
+}
+
+// writeJSONFile writes records as JSON to a file or stdout
+func writeJSONFile(path, compression string, dataList []WeatherData) error {
+	output, err := createOutput(path, compression)
+	if err != nil {
+		return err
+	}
+	if err := OutputJSONFormat(output, dataList); err != nil {
+		output.Abort()
+		return err
+	}
+	return output.Close()
+}
+
+// ndjsonSink writes each record as it arrives as one line of JSON. Without
+// rotation, compression or a templated path it appends to the file, so that
+// every run adds to it; otherwise the lines go to a rotating file that stays
+// open across runs.
+type ndjsonSink struct {
+	target   string
+	output   io.WriteCloser
+	rotating *rotatingFile
+
+	// finishRuns finishes the rotating file at the end of each run, when
+	// it is named after the run or nothing else would finish it
+	finishRuns bool
+}
+
+func newNDJSONSink(target string, config *Config) (Sink, error) {
+	if err := checkPathTemplate(target); err != nil {
+		return nil, err
+	}
+
+	sink := &ndjsonSink{target: target}
+	rotate := config.RotateSize > 0 || config.RotateInterval > 0 ||
+		compressionExtensions[config.OutputCompression] != "" || strings.Contains(target, "{{")
+	if rotate && !isStdout(target) {
+		sink.rotating = sharedRotatingFile(target, config)
+
+		// No later run writes to a path with this run's ID, and without a
+		// size or age limit a part would stay hidden until exit
+		sink.finishRuns = strings.Contains(target, ".RunID") ||
+			(config.RotateSize == 0 && config.RotateInterval == 0)
+	}
+	return sink, nil
+}
+
+func (s *ndjsonSink) Open(ctx context.Context, run RunInfo) error {
+	if s.rotating != nil {
+		path, err := renderPath(s.target, run)
+		if err != nil {
+			return err
+		}
+		return s.rotating.SetPath(path, time.Now())
+	}
+
+	if isStdout(s.target) {
+		s.output = stdoutWriter{os.Stdout}
+		return nil
+	}
+	file, err := os.OpenFile(s.target, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("error opening output file: %w", err)
+	}
+	s.output = file
+	return nil
+}
+
+// Write writes the record and its newline in a single write, so that readers
+// tailing the file never see part of a line from a finished write
+func (s *ndjsonSink) Write(ctx context.Context, data WeatherData) error {
+	line, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error encoding JSON: %w", err)
+	}
+	line = append(line, '\n')
+
+	if s.rotating != nil {
+		err = s.rotating.Write(line, time.Now())
+	} else {
+		_, err = s.output.Write(line)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing NDJSON: %w", err)
+	}
+	return nil
+}
+
+// Flush finishes a file named after the run, since it is complete, or one
+// without a size or age limit, so that each run's records can be read
+func (s *ndjsonSink) Flush(ctx context.Context) error {
+	if s.finishRuns {
+		return s.rotating.Close()
+	}
+	return nil
+}
+
+// Close leaves a rotating file open for the next run
+func (s *ndjsonSink) Close() error {
+	if s.rotating != nil {
+		return nil
+	}
+	return s.output.Close()
+}
+
+// newCSVSink writes a run's records as a CSV table, and the hourly forecast
+// as a second table
+func newCSVSink(target string, config *Config) (Sink, error) {
+	options := config.csvOptions()
+	return newBatchSink(target, config, func(path, compression string, dataList []WeatherData) error {
+		return writeCSVFile(path, compression, options, dataList)
+	})
+}
+
+// writeCSVFile writes records as CSV to a file or stdout. The hourly forecast
+// is a separate table in long format: after a blank line on stdout, or in a
+// file next to the output file.
+func writeCSVFile(path, compression string, options csvOptions, dataList []WeatherData) error {
+	output, err := createOutput(path, compression)
+	if err != nil {
+		return err
+	}
+	if err := OutputCSVFormat(output, dataList, options); err != nil {
+		output.Abort()
+		return err
+	}
+	if err := output.Close(); err != nil {
+		return err
+	}
+
+	if !hasHourly(dataList) {
+		return nil
+	}
+	if isStdout(path) {
+		fmt.Fprintln(os.Stdout)
+		return writeHourlyCSV(os.Stdout, dataList)
+	}
+
+	hourlyOutput, err := createOutput(hourlyOutputPath(path), compression)
+	if err != nil {
+		return fmt.Errorf("error creating hourly output file: %w", err)
+	}
+	if err := writeHourlyCSV(hourlyOutput, dataList); err != nil {
+		hourlyOutput.Abort()
+		return fmt.Errorf("error writing hourly CSV: %w", err)
+	}
+	return hourlyOutput.Close()
+}
+
+// kafkaSink queues each record, and its alerts, for delivery to a topic as
+// it arrives, and waits for delivery on Flush. Records are still delivered
+// when the run is cancelled, since they are released to the sinks after the
+// fetches stop; the producer's delivery timeout bounds how long that takes.
+type kafkaSink struct {
+	topic   string
+	verbose bool
+}
+
+func newKafkaSink(target string, config *Config) (Sink, error) {
+	topic := target
+	if topic == "" {
+		topic = config.KafkaTopic
+	}
+	return &kafkaSink{topic: topic, verbose: config.Verbose}, nil
+}
+
+func (s *kafkaSink) Open(ctx context.Context, run RunInfo) error {
+	if kafkaProducer == nil {
+		return fmt.Errorf("kafka producer not configured")
+	}
+	return nil
+}
+
+func (s *kafkaSink) Write(ctx context.Context, data WeatherData) error {
+	if s.verbose {
+		log.Printf("Sending data for %s to Kafka topic %s", data.LocationID, s.topic)
+	}
+	return kafkaProducer.Send(context.WithoutCancel(ctx), s.topic, data)
+}
+
+// Flush waits for queued records so each run is delivered before the next
+func (s *kafkaSink) Flush(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), kafkaDeliveryTimeout)
+	defer cancel()
+	return kafkaProducer.Flush(ctx)
+}
+
+func (s *kafkaSink) Close() error {
+	return nil
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// captureSink records what the pipeline does with a sink
+type captureSink struct {
+	records []WeatherData
+	flushed bool
+	closed  bool
+	fail    bool
+}
+
+func (s *captureSink) Open(ctx context.Context, run RunInfo) error {
+	return nil
+}
+
+func (s *captureSink) Write(ctx context.Context, data WeatherData) error {
+	if s.fail {
+		return errors.New("disk full")
+	}
+	s.records = append(s.records, data)
+	return nil
+}
+
+func (s *captureSink) Flush(ctx context.Context) error {
+	s.flushed = true
+	return nil
+}
+
+func (s *captureSink) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestSinkSpecs(t *testing.T) {
+	// Without -sink, the output comes from -format and -output
+	specs, err := (&Config{OutputFormat: FormatJSON, OutputPath: "weather.json"}).SinkSpecs()
+	if err != nil || len(specs) != 1 || specs[0] != (SinkSpec{Format: FormatJSON, Target: "weather.json"}) {
+		t.Errorf("Expected json:weather.json, got %v and %v", specs, err)
+	}
+	specs, err = (&Config{OutputFormat: FormatKafka, KafkaTopic: "weather-data"}).SinkSpecs()
+	if err != nil || len(specs) != 1 || specs[0].String() != "kafka:weather-data" {
+		t.Errorf("Expected kafka:weather-data, got %v and %v", specs, err)
+	}
+
+	config := &Config{Sinks: []string{"json:/data/out.json", "KAFKA:weather", "text:-", "csv"}}
+	specs, err = config.SinkSpecs()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := []SinkSpec{
+		{Format: FormatJSON, Target: "/data/out.json"},
+		{Format: FormatKafka, Target: "weather"},
+		{Format: FormatText, Target: "-"},
+		{Format: FormatCSV},
+	}
+	for i, spec := range specs {
+		if spec != expected[i] {
+			t.Errorf("Expected sink %d to be %v, got %v", i, expected[i], spec)
+		}
+	}
+
+	invalid := []*Config{
+		{OutputFormat: "xml"},
+		{Sinks: []string{"xml:/data/out.xml"}},
+		{Sinks: []string{"json:/data/out.json"}, OutputPath: "weather.json"},
+		{Sinks: []string{"json:/data/out", "csv:/data/out"}},
+	}
+	for _, config := range invalid {
+		if _, err := config.SinkSpecs(); err == nil {
+			t.Errorf("Expected sinks %v with format %q and output %q to be rejected", config.Sinks, config.OutputFormat, config.OutputPath)
+		}
+	}
+}
+
+func TestNeedsSummary(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected bool
+	}{
+		// -format defaults to text, but only applies without -sink
+		{[]string{"-sink", "json:/data/out.json", "-sink", "kafka:weather"}, false},
+		{[]string{"-format", "json", "-sink", "text:-"}, true},
+		{[]string{}, true},
+		{[]string{"-format", "json"}, false},
+		{[]string{"-format", "csv"}, true},
+		{[]string{"-format", "csv", "-csv-columns", "location_id,temperature"}, false},
+		{[]string{"-format", "csv", "-csv-columns", "location_id, summary"}, true},
+		{[]string{"-format", "parquet", "-output", "/data/weather.parquet"}, true},
+	}
+
+	for _, test := range tests {
+		config, err := LoadConfig(append(test.args, "80202"), io.Discard)
+		if err != nil {
+			t.Fatalf("Expected no error for %v, got: %v", test.args, err)
+		}
+		if summary := config.needsSummary(); summary != test.expected {
+			t.Errorf("Expected summary %v for %v, got %v", test.expected, test.args, summary)
+		}
+	}
+}
+
+func TestProcessLocationsMultipleSinks(t *testing.T) {
+	RegisterProvider("slow", func(config *Config) (WeatherProvider, error) {
+		return &slowProvider{}, nil
+	})
+	defer delete(providerRegistry, "slow")
+
+	capture := &captureSink{}
+	broken := &captureSink{fail: true}
+	RegisterSink("capture", func(target string, config *Config) (Sink, error) {
+		if target == "broken" {
+			return broken, nil
+		}
+		return capture, nil
+	})
+	defer delete(sinkRegistry, "capture")
+
+	var locations []string
+	for lat := 10; lat < 30; lat++ {
+		locations = append(locations, fmt.Sprintf("coords:%d,0", lat))
+	}
+
+	dir := t.TempDir()
+	config := &Config{
+		Provider:    "slow",
+		Locations:   locations,
+		Sinks:       []string{"capture:broken", "json:" + filepath.Join(dir, "weather.json"), "capture", "csv:" + filepath.Join(dir, "weather.csv")},
+		IsMetric:    true,
+		Concurrency: 8,
+	}
+	ProcessLocations(context.Background(), config)
+
+	// Streaming sinks see every record in input order, even though locations
+	// finish out of order, and a failing sink doesn't hold up the others
+	if len(capture.records) != len(locations) {
+		t.Fatalf("Expected %d records, got %d", len(locations), len(capture.records))
+	}
+	for i, record := range capture.records {
+		if record.Temperature == nil || *record.Temperature != float64(10+i) {
+			t.Errorf("Expected record %d to be for latitude %d, got %v", i, 10+i, record.Temperature)
+		}
+	}
+	if !capture.flushed || !capture.closed || !broken.closed {
+		t.Error("Expected sinks to be flushed and closed at the end of the run")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "weather.json"))
+	if err != nil {
+		t.Fatalf("Expected JSON output file, got: %v", err)
+	}
+	var records []WeatherData
+	if err := json.Unmarshal(data, &records); err != nil || len(records) != len(locations) {
+		t.Errorf("Expected a JSON array of %d records, got %d and %v", len(locations), len(records), err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "weather.csv")); err != nil {
+		t.Errorf("Expected CSV output file, got: %v", err)
+	}
+}
+
+func TestNDJSONSinkAppends(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "weather.ndjson")
+
+	// Each run adds its records to the file
+	for run := 0; run < 2; run++ {
+		sink, err := newNDJSONSink(output, &Config{})
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		info, err := newRunInfo(time.Now())
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		if err := sink.Open(context.Background(), info); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		for _, id := range []string{"zip:90210", "zip:10001"} {
+			if err := sink.Write(context.Background(), WeatherData{LocationID: id, Temperature: ptr(float64(run))}); err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Expected output file, got: %v", err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("Expected 4 lines, got %d: %q", len(lines), data)
+	}
+	for i, line := range lines {
+		var record WeatherData
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Expected line %d to be a JSON object, got: %v", i, err)
+		}
+		if record.Temperature == nil || *record.Temperature != float64(i/2) {
+			t.Errorf("Expected line %d to be from run %d, got %v", i, i/2, record.Temperature)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"weathercli/units"
+)
+
+// applyUnits converts a provider response from metric base units to the
+// configured units. It is applied once per response in the pipeline so that
+// every output format sees the same values.
+func applyUnits(weather *WeatherResponse, spec units.Spec) {
+	weather.Current.Temp = mapOptional(weather.Current.Temp, spec.Temperature.FromCelsius)
+	weather.Current.FeelsLike = mapOptional(weather.Current.FeelsLike, spec.Temperature.FromCelsius)
+	weather.Current.WindSpeed = mapOptional(weather.Current.WindSpeed, spec.Wind.FromMetersPerSecond)
+	weather.Current.Pressure = mapOptional(weather.Current.Pressure, spec.Pressure.FromHectopascals)
+
+	for i := range weather.Daily {
+		weather.Daily[i].Temp.Min = mapOptional(weather.Daily[i].Temp.Min, spec.Temperature.FromCelsius)
+		weather.Daily[i].Temp.Max = mapOptional(weather.Daily[i].Temp.Max, spec.Temperature.FromCelsius)
+		weather.Daily[i].Rain = mapOptional(weather.Daily[i].Rain, spec.Precipitation.FromMillimeters)
+		weather.Daily[i].Snow = mapOptional(weather.Daily[i].Snow, spec.Precipitation.FromMillimeters)
+	}
+
+	for i := range weather.Hourly {
+		weather.Hourly[i].Temp = mapOptional(weather.Hourly[i].Temp, spec.Temperature.FromCelsius)
+		weather.Hourly[i].WindSpeed = mapOptional(weather.Hourly[i].WindSpeed, spec.Wind.FromMetersPerSecond)
+	}
+}
@@ -0,0 +1,256 @@
+// Package units converts weather quantities between unit systems.
+//
+// Providers report values in metric base units (°C, m/s, hPa and mm) and a
+// Spec selects the unit used for each quantity on output.
+package units
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Temperature is a temperature unit
+type Temperature string
+
+const (
+	Celsius    Temperature = "C"
+	Fahrenheit Temperature = "F"
+)
+
+// Speed is a wind speed unit
+type Speed string
+
+const (
+	MetersPerSecond   Speed = "ms"
+	KilometersPerHour Speed = "kmh"
+	MilesPerHour      Speed = "mph"
+	Knots             Speed = "kn"
+	Beaufort          Speed = "beaufort"
+)
+
+// Pressure is an atmospheric pressure unit
+type Pressure string
+
+const (
+	Hectopascals    Pressure = "hpa"
+	InchesOfMercury Pressure = "inhg"
+)
+
+// Precipitation is a precipitation depth unit
+type Precipitation string
+
+const (
+	Millimeters Precipitation = "mm"
+	Inches      Precipitation = "in"
+)
+
+// Spec selects the output unit for each quantity
+type Spec struct {
+	Temperature   Temperature   `json:"temperature"`
+	Wind          Speed         `json:"wind"`
+	Pressure      Pressure      `json:"pressure"`
+	Precipitation Precipitation `json:"precip"`
+}
+
+// Metric returns the metric unit spec (°C, m/s, hPa, mm)
+func Metric() Spec {
+	return Spec{
+		Temperature:   Celsius,
+		Wind:          MetersPerSecond,
+		Pressure:      Hectopascals,
+		Precipitation: Millimeters,
+	}
+}
+
+// Imperial returns the imperial unit spec (°F, mph, inHg, in)
+func Imperial() Spec {
+	return Spec{
+		Temperature:   Fahrenheit,
+		Wind:          MilesPerHour,
+		Pressure:      InchesOfMercury,
+		Precipitation: Inches,
+	}
+}
+
+// IsMetric reports whether every quantity in the spec uses a metric unit
+func (s Spec) IsMetric() bool {
+	metricWind := s.Wind == MetersPerSecond || s.Wind == KilometersPerHour
+	return s.Temperature == Celsius && metricWind && s.Pressure == Hectopascals && s.Precipitation == Millimeters
+}
+
+// Parse applies a comma-separated list of quantity=unit overrides such as
+// "temperature=C,wind=kmh,pressure=hpa,precip=mm" to a base spec
+func Parse(spec string, base Spec) (Spec, error) {
+	result := base
+	if strings.TrimSpace(spec) == "" {
+		return result, nil
+	}
+
+	for _, part := range strings.Split(spec, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return base, fmt.Errorf("invalid unit setting %q (expected quantity=unit)", part)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.ToLower(strings.TrimSpace(value))
+
+		switch key {
+		case "temperature", "temp":
+			switch value {
+			case "c":
+				result.Temperature = Celsius
+			case "f":
+				result.Temperature = Fahrenheit
+			default:
+				return base, fmt.Errorf("invalid temperature unit: %s (expected C or F)", value)
+			}
+		case "wind":
+			switch Speed(value) {
+			case MetersPerSecond, KilometersPerHour, MilesPerHour, Knots, Beaufort:
+				result.Wind = Speed(value)
+			default:
+				return base, fmt.Errorf("invalid wind unit: %s (expected ms, kmh, mph, kn or beaufort)", value)
+			}
+		case "pressure":
+			switch Pressure(value) {
+			case Hectopascals, InchesOfMercury:
+				result.Pressure = Pressure(value)
+			default:
+				return base, fmt.Errorf("invalid pressure unit: %s (expected hpa or inhg)", value)
+			}
+		case "precip", "precipitation":
+			switch Precipitation(value) {
+			case Millimeters, Inches:
+				result.Precipitation = Precipitation(value)
+			default:
+				return base, fmt.Errorf("invalid precipitation unit: %s (expected mm or in)", value)
+			}
+		default:
+			return base, fmt.Errorf("unknown quantity in unit spec: %s", key)
+		}
+	}
+
+	return result, nil
+}
+
+// FromCelsius converts a temperature in °C to this unit
+func (u Temperature) FromCelsius(celsius float64) float64 {
+	if u == Fahrenheit {
+		return CelsiusToFahrenheit(celsius)
+	}
+	return celsius
+}
+
+// Symbol returns the display symbol for the unit
+func (u Temperature) Symbol() string {
+	return "°" + string(u)
+}
+
+// Suffix returns the lowercase suffix used in column names
+func (u Temperature) Suffix() string {
+	return strings.ToLower(string(u))
+}
+
+// beaufortLimits are the upper wind speed limits in m/s for forces 0 to 11
+var beaufortLimits = []float64{0.5, 1.6, 3.4, 5.5, 8.0, 10.8, 13.9, 17.2, 20.8, 24.5, 28.5, 32.7}
+
+// FromMetersPerSecond converts a speed in m/s to this unit
+func (u Speed) FromMetersPerSecond(mps float64) float64 {
+	switch u {
+	case KilometersPerHour:
+		return mps * 3.6
+	case MilesPerHour:
+		return mps * 2.23694
+	case Knots:
+		return mps * 1.94384
+	case Beaufort:
+		for force, limit := range beaufortLimits {
+			if mps < limit {
+				return float64(force)
+			}
+		}
+		return 12
+	default:
+		return mps
+	}
+}
+
+// Symbol returns the display symbol for the unit
+func (u Speed) Symbol() string {
+	switch u {
+	case KilometersPerHour:
+		return "km/h"
+	case MilesPerHour:
+		return "mph"
+	case Knots:
+		return "kn"
+	case Beaufort:
+		return "Bft"
+	default:
+		return "m/s"
+	}
+}
+
+// Suffix returns the lowercase suffix used in column names
+func (u Speed) Suffix() string {
+	return string(u)
+}
+
+// FromHectopascals converts a pressure in hPa to this unit
+func (u Pressure) FromHectopascals(hpa float64) float64 {
+	if u == InchesOfMercury {
+		return hpa * 0.02953
+	}
+	return hpa
+}
+
+// Symbol returns the display symbol for the unit
+func (u Pressure) Symbol() string {
+	if u == InchesOfMercury {
+		return "inHg"
+	}
+	return "hPa"
+}
+
+// Suffix returns the lowercase suffix used in column names
+func (u Pressure) Suffix() string {
+	return string(u)
+}
+
+// FromMillimeters converts a precipitation depth in mm to this unit
+func (u Precipitation) FromMillimeters(mm float64) float64 {
+	if u == Inches {
+		return mm / 25.4
+	}
+	return mm
+}
+
+// Symbol returns the display symbol for the unit
+func (u Precipitation) Symbol() string {
+	return string(u)
+}
+
+// Suffix returns the lowercase suffix used in column names
+func (u Precipitation) Suffix() string {
+	return string(u)
+}
+
+// CelsiusToFahrenheit converts temperature from Celsius to Fahrenheit
+func CelsiusToFahrenheit(celsius float64) float64 {
+	return celsius*9/5 + 32
+}
+
+// FahrenheitToCelsius converts temperature from Fahrenheit to Celsius
+func FahrenheitToCelsius(fahrenheit float64) float64 {
+	return (fahrenheit - 32) * 5 / 9
+}
+
+// KilometersPerHourToMetersPerSecond converts speed from km/h to m/s
+func KilometersPerHourToMetersPerSecond(kmh float64) float64 {
+	return kmh / 3.6
+}
+
+// MilesPerHourToMetersPerSecond converts speed from mph to m/s
+func MilesPerHourToMetersPerSecond(mph float64) float64 {
+	return mph / 2.23694
+}
@@ -0,0 +1,93 @@
+package units
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	spec, err := Parse("temperature=C,wind=kmh,pressure=hpa", Imperial())
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	expected := Spec{Temperature: Celsius, Wind: KilometersPerHour, Pressure: Hectopascals, Precipitation: Inches}
+	if spec != expected {
+		t.Errorf("Expected %+v, got %+v", expected, spec)
+	}
+
+	// An empty spec keeps the base units
+	spec, err = Parse("", Metric())
+	if err != nil || spec != Metric() {
+		t.Errorf("Expected metric units for empty spec, got %+v (%v)", spec, err)
+	}
+
+	invalid := []string{"temperature=K", "wind", "visibility=km", "precip=cm", "pressure=atm"}
+	for _, value := range invalid {
+		if _, err := Parse(value, Metric()); err == nil {
+			t.Errorf("Expected error for %q, got nil", value)
+		}
+	}
+}
+
+func TestSpecIsMetric(t *testing.T) {
+	tests := []struct {
+		spec     string
+		base     Spec
+		expected bool
+	}{
+		{"", Metric(), true},
+		{"", Imperial(), false},
+		{"wind=kmh", Metric(), true},
+		{"temperature=F", Metric(), false},
+		{"wind=beaufort", Metric(), false},
+		{"temperature=C,wind=ms,pressure=hpa,precip=mm", Imperial(), true},
+	}
+	for _, test := range tests {
+		spec, err := Parse(test.spec, test.base)
+		if err != nil {
+			t.Fatalf("Expected no error for %q, got: %v", test.spec, err)
+		}
+		if spec.IsMetric() != test.expected {
+			t.Errorf("Expected IsMetric %t for %q on %+v, got %t", test.expected, test.spec, test.base, !test.expected)
+		}
+	}
+}
+
+func TestSpeedConversion(t *testing.T) {
+	tests := []struct {
+		unit     Speed
+		mps      float64
+		expected float64
+	}{
+		{MetersPerSecond, 10, 10},
+		{KilometersPerHour, 10, 36},
+		{MilesPerHour, 10, 22.3694},
+		{Knots, 10, 19.4384},
+		{Beaufort, 0.2, 0},
+		{Beaufort, 10, 5},
+		{Beaufort, 40, 12},
+	}
+
+	for _, test := range tests {
+		got := test.unit.FromMetersPerSecond(test.mps)
+		if math.Abs(got-test.expected) > 0.0001 {
+			t.Errorf("Expected %v m/s to be %v %s, got %v", test.mps, test.expected, test.unit, got)
+		}
+	}
+
+	if got := MilesPerHourToMetersPerSecond(22.3694); math.Abs(got-10) > 0.0001 {
+		t.Errorf("Expected 22.3694 mph to be 10 m/s, got %v", got)
+	}
+}
+
+func TestTemperatureConversion(t *testing.T) {
+	if got := Fahrenheit.FromCelsius(100); got != 212 {
+		t.Errorf("Expected 212°F, got %v", got)
+	}
+	if got := Celsius.FromCelsius(100); got != 100 {
+		t.Errorf("Expected 100°C, got %v", got)
+	}
+	if got := FahrenheitToCelsius(212); got != 100 {
+		t.Errorf("Expected 100°C, got %v", got)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"weathercli/units"
+)
+
+func TestApplyUnits(t *testing.T) {
+	newWeather := func() WeatherResponse {
+		weather := WeatherResponse{}
+		weather.Current.Temp = ptr(20.0)
+		weather.Current.FeelsLike = ptr(-40.0)
+		weather.Current.WindSpeed = ptr(10.0)
+		weather.Current.Pressure = ptr(1013.25)
+		weather.Daily = make([]struct {
+			Dt   int64 `json:"dt"`
+			Temp struct {
+				Min *float64 `json:"min"`
+				Max *float64 `json:"max"`
+			} `json:"temp"`
+			Weather []struct {
+				Description string `json:"description"`
+			} `json:"weather"`
+			Rain *float64 `json:"rain"`
+			Snow *float64 `json:"snow"`
+		}, 1)
+		weather.Daily[0].Temp.Min = ptr(0.0)
+		weather.Daily[0].Temp.Max = ptr(100.0)
+		weather.Daily[0].Rain = ptr(25.4)
+		return weather
+	}
+
+	// Metric values are left untouched
+	metric := newWeather()
+	applyUnits(&metric, units.Metric())
+	if *metric.Current.Temp != 20 || *metric.Current.WindSpeed != 10 || *metric.Current.Pressure != 1013.25 {
+		t.Errorf("Expected metric values to be unchanged, got %v°C, %v m/s and %v hPa",
+			*metric.Current.Temp, *metric.Current.WindSpeed, *metric.Current.Pressure)
+	}
+
+	// Imperial conversion applies to current and daily values
+	imperial := newWeather()
+	applyUnits(&imperial, units.Imperial())
+	if *imperial.Current.Temp != 68 {
+		t.Errorf("Expected 68°F, got %v", *imperial.Current.Temp)
+	}
+	if *imperial.Current.FeelsLike != -40 {
+		t.Errorf("Expected -40°F, got %v", *imperial.Current.FeelsLike)
+	}
+	if math.Abs(*imperial.Current.WindSpeed-22.37) > 0.01 {
+		t.Errorf("Expected 22.37 mph, got %v", *imperial.Current.WindSpeed)
+	}
+	if math.Abs(*imperial.Current.Pressure-29.92) > 0.01 {
+		t.Errorf("Expected 29.92 inHg, got %v", *imperial.Current.Pressure)
+	}
+	if *imperial.Daily[0].Temp.Min != 32 || *imperial.Daily[0].Temp.Max != 212 {
+		t.Errorf("Expected daily 32°F and 212°F, got %v and %v", *imperial.Daily[0].Temp.Min, *imperial.Daily[0].Temp.Max)
+	}
+	if *imperial.Daily[0].Rain != 1 {
+		t.Errorf("Expected 1 in of rain, got %v", *imperial.Daily[0].Rain)
+	}
+}
+
+func TestConfigUnits(t *testing.T) {
+	config := &Config{IsMetric: true, UnitsSpec: "wind=kmh"}
+	spec, err := config.Units()
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if spec.Temperature != units.Celsius || spec.Wind != units.KilometersPerHour {
+		t.Errorf("Expected °C with km/h, got %+v", spec)
+	}
+
+	config = &Config{
+		ZipCodes:     []string{"90210"},
+		OutputFormat: FormatText,
+		UnitsSpec:    "wind=furlongs",
+	}
+	if err := ValidateConfig(config); err == nil {
+		t.Error("Expected error for invalid units, got nil")
+	}
+}
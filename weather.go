@@ -3,47 +3,88 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math"
 	"net/http"
 	"net/url"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	openai "github.com/sashabaranov/go-openai"
+
+	"weathercli/gazetteer"
+	"weathercli/units"
 )
 
 const (
-	geoEndpoint     = "https://api.openweathermap.org/geo/1.0/zip"
-	weatherEndpoint = "https://api.openweathermap.org/data/3.0/onecall"
-	openAIModel     = openai.GPT3Dot5Turbo
+	openAIModel = openai.GPT3Dot5Turbo
+
+	// Number of nearby NWS stations to try for current observations, and the
+	// oldest observation accepted
+	maxNWSStations       = 5
+	maxNWSObservationAge = 2 * time.Hour
 
-	// National Weather Service API endpoints
-	nwsPointsEndpoint = "https://api.weather.gov/points"
+	// User-Agent sent to APIs that require clients to identify themselves,
+	// unless -user-agent gives one with contact details
+	defaultUserAgent = "weathercli/1.0"
 )
 
 // WeatherData represents the processed weather data ready for pipeline
 type WeatherData struct {
 	LocationID   string    `json:"location_id"`
 	LocationName string    `json:"location_name"`
+	Latitude     float64   `json:"latitude"`
+	Longitude    float64   `json:"longitude"`
 	Timestamp    time.Time `json:"timestamp"`
-	Temperature  float64   `json:"temperature"`
-	FeelsLike    float64   `json:"feels_like"`
-	TempMin      float64   `json:"temp_min"`
-	TempMax      float64   `json:"temp_max"`
-	Humidity     int       `json:"humidity"`
-	WindSpeed    float64   `json:"wind_speed"`
+	Temperature  *float64  `json:"temperature"`
+	FeelsLike    *float64  `json:"feels_like"`
+	TempMin      *float64  `json:"temp_min"`
+	TempMax      *float64  `json:"temp_max"`
+	Humidity     *int      `json:"humidity"`
+	WindSpeed    *float64  `json:"wind_speed"`
+	Pressure     *float64  `json:"pressure"`
 	Condition    string    `json:"condition"`
 	ForecastDays int       `json:"forecast_days"`
 	Forecast     []struct {
-		Date      time.Time `json:"date"`
-		TempMin   float64   `json:"temp_min"`
-		TempMax   float64   `json:"temp_max"`
-		Condition string    `json:"condition"`
+		Date          time.Time `json:"date"`
+		TempMin       *float64  `json:"temp_min"`
+		TempMax       *float64  `json:"temp_max"`
+		Condition     string    `json:"condition"`
+		Precipitation *float64  `json:"precipitation"`
 	} `json:"forecast"`
-	Summary  string `json:"summary,omitempty"`
-	IsMetric bool   `json:"is_metric"`
+
+	// Hourly is the hourly forecast, when requested with -hourly
+	Hourly []HourlyForecast `json:"hourly,omitempty"`
+
+	// Alerts are the weather alerts in effect, most severe first
+	Alerts []WeatherAlert `json:"alerts,omitempty"`
+
+	Summary string `json:"summary,omitempty"`
+	Source  string `json:"source"`
+
+	// IsMetric is true when every quantity is in a metric unit; Units
+	// holds the unit of each quantity
+	IsMetric bool       `json:"is_metric"`
+	Units    units.Spec `json:"units"`
+
+	// Station and ObservedAt identify the observation behind the current
+	// conditions, when the provider reports them
+	Station    string     `json:"station,omitempty"`
+	ObservedAt *time.Time `json:"observed_at,omitempty"`
+}
+
+// HourlyForecast is one hour of the processed hourly forecast
+type HourlyForecast struct {
+	Time              time.Time `json:"time"`
+	Temperature       *float64  `json:"temperature"`
+	PrecipProbability *int      `json:"precip_probability"`
+	WindSpeed         *float64  `json:"wind_speed"`
+	Condition         string    `json:"condition"`
 }
 
 type GeoResponse struct {
@@ -52,12 +93,16 @@ type GeoResponse struct {
 	Name string  `json:"name"`
 }
 
+// WeatherResponse is the provider-neutral weather report. Providers always
+// return metric values (°C, m/s, hPa and mm); the pipeline converts them to
+// the configured units. Measurements a provider didn't report are nil.
 type WeatherResponse struct {
 	Current struct {
-		Temp      float64 `json:"temp"`
-		FeelsLike float64 `json:"feels_like"`
-		Humidity  int     `json:"humidity"`
-		WindSpeed float64 `json:"wind_speed"`
+		Temp      *float64 `json:"temp"`
+		FeelsLike *float64 `json:"feels_like"`
+		Humidity  *int     `json:"humidity"`
+		WindSpeed *float64 `json:"wind_speed"`
+		Pressure  *float64 `json:"pressure"`
 		Weather   []struct {
 			Description string `json:"description"`
 		} `json:"weather"`
@@ -65,13 +110,39 @@ type WeatherResponse struct {
 	Daily []struct {
 		Dt   int64 `json:"dt"`
 		Temp struct {
-			Min float64 `json:"min"`
-			Max float64 `json:"max"`
+			Min *float64 `json:"min"`
+			Max *float64 `json:"max"`
 		} `json:"temp"`
 		Weather []struct {
 			Description string `json:"description"`
 		} `json:"weather"`
+		Rain *float64 `json:"rain"`
+		Snow *float64 `json:"snow"`
 	} `json:"daily"`
+	Hourly []HourlyWeather `json:"hourly"`
+
+	// Alerts are the weather alerts in effect
+	Alerts []WeatherAlert `json:"-"`
+
+	// Provider is the name of the provider that produced the response
+	Provider string `json:"-"`
+
+	// Station and ObservedAt identify the observation behind the current
+	// conditions, when the provider reports them
+	Station    string    `json:"-"`
+	ObservedAt time.Time `json:"-"`
+}
+
+// HourlyWeather is one hour of a provider's hourly forecast. Pop is the
+// probability of precipitation from 0 to 1.
+type HourlyWeather struct {
+	Dt        int64    `json:"dt"`
+	Temp      *float64 `json:"temp"`
+	Pop       *float64 `json:"pop"`
+	WindSpeed *float64 `json:"wind_speed"`
+	Weather   []struct {
+		Description string `json:"description"`
+	} `json:"weather"`
 }
 
 // NWS API response types
@@ -94,11 +165,14 @@ type NWSForecastResponse struct {
 			StartTime        string  `json:"startTime"`
 			EndTime          string  `json:"endTime"`
 			Temperature      float64 `json:"temperature"`
+			TemperatureUnit  string  `json:"temperatureUnit"`
 			WindSpeed        string  `json:"windSpeed"`
 			WindDirection    string  `json:"windDirection"`
 			ShortForecast    string  `json:"shortForecast"`
 			DetailedForecast string  `json:"detailedForecast"`
 			IsDaytime        bool    `json:"isDaytime"`
+
+			ProbabilityOfPrecipitation NWSValue `json:"probabilityOfPrecipitation"`
 		} `json:"periods"`
 	} `json:"properties"`
 }
@@ -113,22 +187,39 @@ type NWSStationsResponse struct {
 
 type NWSObservationResponse struct {
 	Properties struct {
-		Temperature struct {
-			Value float64 `json:"value"`
-		} `json:"temperature"`
-		WindSpeed struct {
-			Value float64 `json:"value"`
-		} `json:"windSpeed"`
-		RelativeHumidity struct {
-			Value float64 `json:"value"`
-		} `json:"relativeHumidity"`
-		HeatIndex struct {
-			Value float64 `json:"value"`
-		} `json:"heatIndex"`
-		TextDescription string `json:"textDescription"`
+		Timestamp        string   `json:"timestamp"`
+		Temperature      NWSValue `json:"temperature"`
+		WindSpeed        NWSValue `json:"windSpeed"`
+		RelativeHumidity NWSValue `json:"relativeHumidity"`
+		SeaLevelPressure NWSValue `json:"seaLevelPressure"`
+		HeatIndex        NWSValue `json:"heatIndex"`
+		WindChill        NWSValue `json:"windChill"`
+		TextDescription  string   `json:"textDescription"`
 	} `json:"properties"`
 }
 
+// NWSValue is a measured value in an NWS observation. Value is nil when the
+// station didn't report it, and QualityControl holds the MADIS quality
+// control code.
+type NWSValue struct {
+	Value          *float64 `json:"value"`
+	UnitCode       string   `json:"unitCode"`
+	QualityControl string   `json:"qualityControl"`
+}
+
+// nwsRejectedQC are the quality control codes of values that failed checks:
+// X (rejected), Q (questioned) and B (subjectively bad)
+var nwsRejectedQC = map[string]bool{"X": true, "Q": true, "B": true}
+
+// Get returns the value, reporting false if it is missing or failed quality
+// control
+func (v NWSValue) Get() (float64, bool) {
+	if v.Value == nil || nwsRejectedQC[v.QualityControl] {
+		return 0, false
+	}
+	return *v.Value, true
+}
+
 func isValidZip(zip string) bool {
 	if len(zip) != 5 {
 		return false
@@ -141,45 +232,24 @@ func isValidZip(zip string) bool {
 	return true
 }
 
-func validateURL(rawURL string) error {
-	parsedURL, err := url.Parse(rawURL)
-	if err != nil {
-		return fmt.Errorf("invalid URL: %w", err)
-	}
-
-	if parsedURL.Scheme != "https" {
-		return fmt.Errorf("URL must use HTTPS")
-	}
-
-	allowedHosts := []string{"openweathermap.org", "api.weather.gov"}
-	allowed := false
-	for _, host := range allowedHosts {
-		if strings.HasSuffix(parsedURL.Host, host) {
-			allowed = true
-			break
-		}
-	}
-
-	if !allowed {
-		return fmt.Errorf("URL host not allowed: %s", parsedURL.Host)
-	}
-
-	return nil
-}
-
-func getCoordinates(zip string, apiKey string) (float64, float64, string, error) {
-	// If no API key is provided, use the Census geocoding API to get coordinates
+func getCoordinates(ctx context.Context, zip string, apiKey string) (float64, float64, string, error) {
+	// If no API key is provided, use the offline ZIP code gazetteer
 	if apiKey == "" {
-		return getNWSCoordinates(zip)
+		return lookupZipCoordinates(zip)
 	}
 
-	urlStr := fmt.Sprintf("%s?zip=%s,US&appid=%s", geoEndpoint, zip, apiKey)
+	urlStr := fmt.Sprintf("%s%s?zip=%s,US&appid=%s", endpoints.OWM, geoEndpoint, zip, apiKey)
 
 	if err := validateURL(urlStr); err != nil {
 		return 0, 0, "", fmt.Errorf("URL validation failed: %w", err)
 	}
 
-	resp, err := http.Get(urlStr) //nolint
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return 0, 0, "", fmt.Errorf("error getting geocode: %w", err)
 	}
@@ -196,53 +266,40 @@ func getCoordinates(zip string, apiKey string) (float64, float64, string, error)
 	return geo.Lat, geo.Lon, geo.Name, nil
 }
 
-// getNWSCoordinates uses a simple approximation for ZIP code to coordinates
-// In a production app, you would use a proper geocoding service
-func getNWSCoordinates(zip string) (float64, float64, string, error) {
-	// This is a simplified approach - in production, use a proper geocoding service
-	// For this example, we'll use a hardcoded mapping for a few ZIP codes
-	zipCoords := map[string]struct {
-		lat  float64
-		lon  float64
-		city string
-	}{
-		"90210": {34.0901, -118.4065, "Beverly Hills"},
-		"10001": {40.7501, -73.9996, "New York"},
-		"60601": {41.8841, -87.6277, "Chicago"},
-		"02108": {42.3581, -71.0636, "Boston"},
-		"94102": {37.7794, -122.4184, "San Francisco"},
-		"98101": {47.6097, -122.3331, "Seattle"},
-		"33101": {25.7743, -80.1937, "Miami"},
-		"75201": {32.7795, -96.8022, "Dallas"},
-		"77001": {29.7604, -95.3698, "Houston"},
-		"85001": {33.4484, -112.0740, "Phoenix"},
-	}
-
-	if coords, ok := zipCoords[zip]; ok {
-		return coords.lat, coords.lon, coords.city, nil
-	}
-
-	// For unknown ZIP codes, use a default location (NYC)
-	return 40.7128, -74.0060, "New York", nil
-}
+// errUnknownZIP reports a ZIP code missing from the gazetteer
+var errUnknownZIP = errors.New("unknown ZIP code")
 
-func getWeather(lat, lon float64, apiKey string) (WeatherResponse, error) {
-	// If no API key is provided, use the National Weather Service API
-	if apiKey == "" {
-		return getNWSWeather(lat, lon)
+// lookupZipCoordinates finds a ZIP code in the embedded Census gazetteer
+func lookupZipCoordinates(zip string) (float64, float64, string, error) {
+	place, ok, err := gazetteer.Lookup(zip)
+	if err != nil {
+		return 0, 0, "", fmt.Errorf("error reading ZIP code gazetteer: %w", err)
+	}
+	if !ok {
+		return 0, 0, "", fmt.Errorf("%w: %s", errUnknownZIP, zip)
 	}
+	return place.Lat, place.Lon, place.City, nil
+}
 
-	units := "imperial"
-	if false { // Default is imperial, change based on config in real implementation
-		units = "metric"
+// getOWMWeather fetches weather data from the OpenWeatherMap One Call API,
+// including the hourly forecast if requested
+func getOWMWeather(ctx context.Context, lat, lon float64, apiKey string, hourly bool) (WeatherResponse, error) {
+	exclude := "minutely,hourly"
+	if hourly {
+		exclude = "minutely"
 	}
-	urlStr := fmt.Sprintf("%s?lat=%f&lon=%f&exclude=minutely,hourly,alerts&units=%s&appid=%s", weatherEndpoint, lat, lon, units, apiKey)
+	urlStr := fmt.Sprintf("%s%s?lat=%f&lon=%f&exclude=%s&units=metric&appid=%s", endpoints.OWM, weatherEndpoint, lat, lon, exclude, apiKey)
 
 	if err := validateURL(urlStr); err != nil {
 		return WeatherResponse{}, fmt.Errorf("URL validation failed: %w", err)
 	}
 
-	resp, err := http.Get(urlStr) //nolint
+	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	if err != nil {
+		return WeatherResponse{}, fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return WeatherResponse{}, fmt.Errorf("error fetching weather: %w", err)
 	}
@@ -252,138 +309,370 @@ func getWeather(lat, lon float64, apiKey string) (WeatherResponse, error) {
 		return WeatherResponse{}, fmt.Errorf("weather API error: status code %d", resp.StatusCode)
 	}
 
-	var weather WeatherResponse
-	if err := json.NewDecoder(resp.Body).Decode(&weather); err != nil {
+	var data struct {
+		WeatherResponse
+		Alerts []owmAlert `json:"alerts"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
 		return WeatherResponse{}, fmt.Errorf("error decoding weather response: %w", err)
 	}
+	weather := data.WeatherResponse
+	weather.Alerts = convertOWMAlerts(data.Alerts)
+
+	// OpenWeatherMap leaves out rain and snow on dry days
+	for i := range weather.Daily {
+		if weather.Daily[i].Rain == nil {
+			weather.Daily[i].Rain = ptr(0.0)
+		}
+		if weather.Daily[i].Snow == nil {
+			weather.Daily[i].Snow = ptr(0.0)
+		}
+	}
+
+	weather.Provider = "owm"
 	return weather, nil
 }
 
-// getNWSWeather fetches weather data from the National Weather Service API
-func getNWSWeather(lat, lon float64) (WeatherResponse, error) {
-	// Step 1: Get the forecast points URL
-	pointsURL := fmt.Sprintf("%s/%.4f,%.4f", nwsPointsEndpoint, lat, lon)
+// getNWSPoint fetches the forecast and station URLs for a location. Point
+// metadata never changes, so it is served from the cache when possible.
+func getNWSPoint(ctx context.Context, client *http.Client, lat, lon float64, cache *Cache) (NWSPointResponse, error) {
+	var pointsData NWSPointResponse
+	pointsURL := fmt.Sprintf("%s%s/%.4f,%.4f", endpoints.NWS, nwsPointsEndpoint, lat, lon)
+
+	if cache.Get("nws:points:"+pointsURL, &pointsData) {
+		return pointsData, nil
+	}
 
 	if err := validateURL(pointsURL); err != nil {
-		return WeatherResponse{}, fmt.Errorf("URL validation failed: %w", err)
+		return pointsData, fmt.Errorf("URL validation failed: %w", err)
 	}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", pointsURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", pointsURL, nil)
 	if err != nil {
-		return WeatherResponse{}, fmt.Errorf("error creating request: %w", err)
+		return pointsData, fmt.Errorf("error creating request: %w", err)
 	}
 
 	// NWS API requires a User-Agent header
-	req.Header.Set("User-Agent", "WeatherPipeline/1.0 (https://github.com/user/weather-pipeline)")
+	req.Header.Set("User-Agent", userAgent)
 
 	pointsResp, err := client.Do(req)
 	if err != nil {
-		return WeatherResponse{}, fmt.Errorf("error fetching NWS points: %w", err)
+		return pointsData, fmt.Errorf("error fetching NWS points: %w", err)
 	}
 	defer pointsResp.Body.Close()
 
 	if pointsResp.StatusCode != http.StatusOK {
-		return WeatherResponse{}, fmt.Errorf("NWS API error: status code %d", pointsResp.StatusCode)
+		return pointsData, fmt.Errorf("NWS API error: status code %d", pointsResp.StatusCode)
 	}
 
-	var pointsData NWSPointResponse
 	if err := json.NewDecoder(pointsResp.Body).Decode(&pointsData); err != nil {
-		return WeatherResponse{}, fmt.Errorf("error decoding NWS points response: %w", err)
+		return pointsData, fmt.Errorf("error decoding NWS points response: %w", err)
 	}
 
-	// Step 2: Get the forecast data
-	forecastURL := pointsData.Properties.Forecast
-	req, err = http.NewRequest("GET", forecastURL, nil)
-	if err != nil {
-		return WeatherResponse{}, fmt.Errorf("error creating forecast request: %w", err)
+	if err := cache.Set("nws:points:"+pointsURL, pointsData); err != nil {
+		log.Printf("Error updating cache: %v", err)
 	}
-	req.Header.Set("User-Agent", "WeatherPipeline/1.0 (https://github.com/user/weather-pipeline)")
+	return pointsData, nil
+}
 
-	forecastResp, err := client.Do(req)
-	if err != nil {
-		return WeatherResponse{}, fmt.Errorf("error fetching NWS forecast: %w", err)
-	}
-	defer forecastResp.Body.Close()
+// getNWSStations fetches the observation stations near a point, using the
+// cache when possible
+func getNWSStations(ctx context.Context, client *http.Client, stationsURL string, cache *Cache) (NWSStationsResponse, error) {
+	var stationsData NWSStationsResponse
 
-	if forecastResp.StatusCode != http.StatusOK {
-		return WeatherResponse{}, fmt.Errorf("NWS forecast API error: status code %d", forecastResp.StatusCode)
+	if cache.Get("nws:stations:"+stationsURL, &stationsData) {
+		return stationsData, nil
 	}
 
-	var forecastData NWSForecastResponse
-	if err := json.NewDecoder(forecastResp.Body).Decode(&forecastData); err != nil {
-		return WeatherResponse{}, fmt.Errorf("error decoding NWS forecast response: %w", err)
+	if err := validateURL(stationsURL); err != nil {
+		return stationsData, fmt.Errorf("URL validation failed: %w", err)
 	}
 
-	// Step 3: Get observation station
-	stationsURL := pointsData.Properties.ObservationStations
-	req, err = http.NewRequest("GET", stationsURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", stationsURL, nil)
 	if err != nil {
-		return WeatherResponse{}, fmt.Errorf("error creating stations request: %w", err)
+		return stationsData, fmt.Errorf("error creating stations request: %w", err)
 	}
-	req.Header.Set("User-Agent", "WeatherPipeline/1.0 (https://github.com/user/weather-pipeline)")
+	req.Header.Set("User-Agent", userAgent)
 
 	stationsResp, err := client.Do(req)
 	if err != nil {
-		return WeatherResponse{}, fmt.Errorf("error fetching NWS stations: %w", err)
+		return stationsData, fmt.Errorf("error fetching NWS stations: %w", err)
 	}
 	defer stationsResp.Body.Close()
 
 	if stationsResp.StatusCode != http.StatusOK {
-		return WeatherResponse{}, fmt.Errorf("NWS stations API error: status code %d", stationsResp.StatusCode)
+		return stationsData, fmt.Errorf("NWS stations API error: status code %d", stationsResp.StatusCode)
 	}
 
-	var stationsData NWSStationsResponse
 	if err := json.NewDecoder(stationsResp.Body).Decode(&stationsData); err != nil {
-		return WeatherResponse{}, fmt.Errorf("error decoding NWS stations response: %w", err)
+		return stationsData, fmt.Errorf("error decoding NWS stations response: %w", err)
 	}
 
-	if len(stationsData.Features) == 0 {
-		return WeatherResponse{}, fmt.Errorf("no observation stations found")
+	if err := cache.Set("nws:stations:"+stationsURL, stationsData); err != nil {
+		log.Printf("Error updating cache: %v", err)
 	}
+	return stationsData, nil
+}
+
+// getNWSObservation fetches the latest observation from a station
+func getNWSObservation(ctx context.Context, client *http.Client, stationID string) (NWSObservationResponse, error) {
+	var obsData NWSObservationResponse
+	observationURL := fmt.Sprintf("%s%s/%s/observations/latest", endpoints.NWS, nwsStationsEndpoint, url.PathEscape(stationID))
 
-	// Step 4: Get current observations
-	stationID := stationsData.Features[0].Properties.StationIdentifier
-	observationURL := fmt.Sprintf("https://api.weather.gov/stations/%s/observations/latest", stationID)
-	req, err = http.NewRequest("GET", observationURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", observationURL, nil)
 	if err != nil {
-		return WeatherResponse{}, fmt.Errorf("error creating observation request: %w", err)
+		return obsData, fmt.Errorf("error creating observation request: %w", err)
 	}
-	req.Header.Set("User-Agent", "WeatherPipeline/1.0 (https://github.com/user/weather-pipeline)")
+	req.Header.Set("User-Agent", userAgent)
 
 	obsResp, err := client.Do(req)
 	if err != nil {
-		return WeatherResponse{}, fmt.Errorf("error fetching NWS observations: %w", err)
+		return obsData, fmt.Errorf("error fetching NWS observations: %w", err)
 	}
 	defer obsResp.Body.Close()
 
 	if obsResp.StatusCode != http.StatusOK {
-		return WeatherResponse{}, fmt.Errorf("NWS observations API error: status code %d", obsResp.StatusCode)
+		return obsData, fmt.Errorf("NWS observations API error: status code %d", obsResp.StatusCode)
 	}
 
-	var obsData NWSObservationResponse
 	if err := json.NewDecoder(obsResp.Body).Decode(&obsData); err != nil {
-		return WeatherResponse{}, fmt.Errorf("error decoding NWS observation response: %w", err)
+		return obsData, fmt.Errorf("error decoding NWS observation response: %w", err)
+	}
+	return obsData, nil
+}
+
+// selectNWSObservation tries stations in order until one has a recent
+// observation whose temperature passed quality control. It returns the
+// observation with the station and time it was taken.
+func selectNWSObservation(ctx context.Context, client *http.Client, stations []string, now time.Time) (NWSObservationResponse, string, time.Time, error) {
+	if len(stations) > maxNWSStations {
+		stations = stations[:maxNWSStations]
+	}
+
+	var errs []error
+	for _, stationID := range stations {
+		obsData, err := getNWSObservation(ctx, client, stationID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return obsData, "", time.Time{}, err
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", stationID, err))
+			continue
+		}
+
+		observedAt, err := time.Parse(time.RFC3339, obsData.Properties.Timestamp)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("%s: observation has no valid timestamp", stationID))
+		case now.Sub(observedAt) > maxNWSObservationAge:
+			errs = append(errs, fmt.Errorf("%s: latest observation is from %s", stationID, observedAt.Format(time.RFC3339)))
+		default:
+			if _, ok := obsData.Properties.Temperature.Get(); !ok {
+				errs = append(errs, fmt.Errorf("%s: temperature missing or failed quality control", stationID))
+				continue
+			}
+			return obsData, stationID, observedAt, nil
+		}
+	}
+
+	if len(errs) == 0 {
+		return NWSObservationResponse{}, "", time.Time{}, fmt.Errorf("no observation stations found")
+	}
+	return NWSObservationResponse{}, "", time.Time{}, fmt.Errorf("no usable observations: %w", errors.Join(errs...))
+}
+
+// nwsCelsius returns an NWS temperature in °C, or nil if it is missing or
+// failed quality control
+func nwsCelsius(v NWSValue) *float64 {
+	value, ok := v.Get()
+	if !ok {
+		return nil
+	}
+	if v.UnitCode == "wmoUnit:degF" {
+		value = units.FahrenheitToCelsius(value)
+	}
+	return &value
+}
+
+// getNWSForecast fetches a forecast from one of the URLs in the point
+// metadata. The daily and hourly forecasts share a format.
+func getNWSForecast(ctx context.Context, client *http.Client, forecastURL string) (NWSForecastResponse, error) {
+	var forecastData NWSForecastResponse
+	forecastURL = nwsURL(forecastURL)
+	if err := validateURL(forecastURL); err != nil {
+		return forecastData, fmt.Errorf("URL validation failed: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", forecastURL, nil)
+	if err != nil {
+		return forecastData, fmt.Errorf("error creating forecast request: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+
+	forecastResp, err := client.Do(req)
+	if err != nil {
+		return forecastData, fmt.Errorf("error fetching NWS forecast: %w", err)
+	}
+	defer forecastResp.Body.Close()
+
+	if forecastResp.StatusCode != http.StatusOK {
+		return forecastData, fmt.Errorf("NWS forecast API error: status code %d", forecastResp.StatusCode)
+	}
+
+	if err := json.NewDecoder(forecastResp.Body).Decode(&forecastData); err != nil {
+		return forecastData, fmt.Errorf("error decoding NWS forecast response: %w", err)
+	}
+	return forecastData, nil
+}
+
+// convertNWSHourly maps NWS hourly forecast periods onto HourlyWeather
+func convertNWSHourly(forecastData NWSForecastResponse) []HourlyWeather {
+	var hourly []HourlyWeather
+	for _, period := range forecastData.Properties.Periods {
+		startTime, err := time.Parse(time.RFC3339, period.StartTime)
+		if err != nil {
+			continue
+		}
+
+		hour := HourlyWeather{
+			Dt:        startTime.Unix(),
+			Temp:      ptr(period.Temperature),
+			WindSpeed: parseNWSWindSpeed(period.WindSpeed),
+			Weather: []struct {
+				Description string `json:"description"`
+			}{{Description: period.ShortForecast}},
+		}
+		if period.TemperatureUnit == "F" {
+			hour.Temp = ptr(units.FahrenheitToCelsius(period.Temperature))
+		}
+		if pop, ok := period.ProbabilityOfPrecipitation.Get(); ok {
+			hour.Pop = ptr(pop / 100)
+		}
+		hourly = append(hourly, hour)
+	}
+	return hourly
+}
+
+// parseNWSWindSpeed parses a forecast wind speed such as "10 mph" or
+// "5 to 10 mph" into m/s, using the upper end of a range. It returns nil if the
+// speed can't be parsed.
+func parseNWSWindSpeed(value string) *float64 {
+	fields := strings.Fields(value)
+	if len(fields) < 2 {
+		return nil
+	}
+	speed, err := strconv.ParseFloat(fields[len(fields)-2], 64)
+	if err != nil {
+		return nil
+	}
+	switch fields[len(fields)-1] {
+	case "mph":
+		return ptr(units.MilesPerHourToMetersPerSecond(speed))
+	case "km/h":
+		return ptr(units.KilometersPerHourToMetersPerSecond(speed))
+	}
+	return nil
+}
+
+// getNWSWeather fetches weather data from the National Weather Service API,
+// including the hourly forecast if requested
+func getNWSWeather(ctx context.Context, lat, lon float64, cache *Cache, hourly bool) (WeatherResponse, error) {
+	return fetchNWSWeather(ctx, lat, lon, cache, hourly, time.Now())
+}
+
+// fetchNWSWeather fetches weather data from the National Weather Service API,
+// accepting observations that are recent as of now
+func fetchNWSWeather(ctx context.Context, lat, lon float64, cache *Cache, hourly bool, now time.Time) (WeatherResponse, error) {
+	client := httpClient
+
+	// Step 1: Get the forecast points URL
+	pointsData, err := getNWSPoint(ctx, client, lat, lon, cache)
+	if err != nil {
+		return WeatherResponse{}, err
+	}
+
+	// Step 2: Get the forecast data
+	forecastData, err := getNWSForecast(ctx, client, pointsData.Properties.Forecast)
+	if err != nil {
+		return WeatherResponse{}, err
+	}
+
+	// The daily forecast is still useful without the hourly one, so a
+	// failure is only logged
+	var hourlyData NWSForecastResponse
+	if hourly {
+		hourlyData, err = getNWSForecast(ctx, client, pointsData.Properties.ForecastHourly)
+		if err != nil {
+			if ctx.Err() != nil {
+				return WeatherResponse{}, err
+			}
+			log.Printf("Error fetching NWS hourly forecast: %v", err)
+		}
+	}
+
+	// Step 3: Get observation station
+	stationsData, err := getNWSStations(ctx, client, nwsURL(pointsData.Properties.ObservationStations), cache)
+	if err != nil {
+		return WeatherResponse{}, err
+	}
+
+	// Step 4: Get current observations from the nearest station with usable data
+	stations := make([]string, len(stationsData.Features))
+	for i, feature := range stationsData.Features {
+		stations[i] = feature.Properties.StationIdentifier
+	}
+
+	obsData, stationID, observedAt, err := selectNWSObservation(ctx, client, stations, now)
+	if err != nil {
+		return WeatherResponse{}, err
+	}
+
+	// Step 5: Get the alerts in effect. The forecast is still useful without
+	// them, so a failure is only logged.
+	alerts, err := getNWSAlerts(ctx, client, lat, lon)
+	if err != nil {
+		if ctx.Err() != nil {
+			return WeatherResponse{}, err
+		}
+		log.Printf("Error fetching NWS alerts: %v", err)
 	}
 
 	// Convert NWS data to our standard WeatherResponse format
-	weather := WeatherResponse{}
+	weather := WeatherResponse{Provider: "nws", Station: stationID, ObservedAt: observedAt}
+	weather.Hourly = convertNWSHourly(hourlyData)
+	weather.Alerts = alerts
+
+	// Current conditions (observations are reported in °C)
+	weather.Current.Temp = nwsCelsius(obsData.Properties.Temperature)
 
-	// Current conditions
-	weather.Current.Temp = celsiusToFahrenheit(obsData.Properties.Temperature.Value)
+	// Use the heat index or wind chill if reported, otherwise the temperature
+	weather.Current.FeelsLike = weather.Current.Temp
+	if feelsLike := nwsCelsius(obsData.Properties.HeatIndex); feelsLike != nil {
+		weather.Current.FeelsLike = feelsLike
+	} else if feelsLike := nwsCelsius(obsData.Properties.WindChill); feelsLike != nil {
+		weather.Current.FeelsLike = feelsLike
+	}
 
-	// Use heat index if available, otherwise use temperature
-	feelsLike := obsData.Properties.Temperature.Value
-	if obsData.Properties.HeatIndex.Value != 0 {
-		feelsLike = obsData.Properties.HeatIndex.Value
+	// Observations usually report wind speed in km/h
+	if windSpeed, ok := obsData.Properties.WindSpeed.Get(); ok {
+		if obsData.Properties.WindSpeed.UnitCode == "wmoUnit:km_h-1" {
+			windSpeed = units.KilometersPerHourToMetersPerSecond(windSpeed)
+		}
+		weather.Current.WindSpeed = &windSpeed
 	}
-	weather.Current.FeelsLike = celsiusToFahrenheit(feelsLike)
 
-	// Convert m/s to mph for wind speed
-	weather.Current.WindSpeed = obsData.Properties.WindSpeed.Value * 2.237
+	// Pressure is reported in pascals
+	if pressure, ok := obsData.Properties.SeaLevelPressure.Get(); ok {
+		if obsData.Properties.SeaLevelPressure.UnitCode == "wmoUnit:Pa" {
+			pressure /= 100
+		}
+		weather.Current.Pressure = &pressure
+	}
 
 	// Convert relative humidity from percentage (0-100) to integer
-	weather.Current.Humidity = int(obsData.Properties.RelativeHumidity.Value)
+	if humidity, ok := obsData.Properties.RelativeHumidity.Get(); ok {
+		weather.Current.Humidity = ptr(int(math.Round(humidity)))
+	}
 
 	// Set weather description
 	weather.Current.Weather = []struct {
@@ -394,19 +683,23 @@ func getNWSWeather(lat, lon float64) (WeatherResponse, error) {
 	weather.Daily = make([]struct {
 		Dt   int64 `json:"dt"`
 		Temp struct {
-			Min float64 `json:"min"`
-			Max float64 `json:"max"`
+			Min *float64 `json:"min"`
+			Max *float64 `json:"max"`
 		} `json:"temp"`
 		Weather []struct {
 			Description string `json:"description"`
 		} `json:"weather"`
+		Rain *float64 `json:"rain"`
+		Snow *float64 `json:"snow"`
 	}, 0)
 
 	// Group forecast periods by day (NWS provides 12-hour periods)
+	// Night periods give the low and day periods the high, so a day without
+	// either has no value for it rather than a guess from the other.
 	dayMap := make(map[string]struct {
 		date        time.Time
-		minTemp     float64
-		maxTemp     float64
+		minTemp     *float64
+		maxTemp     *float64
 		description string
 	})
 
@@ -419,30 +712,26 @@ func getNWSWeather(lat, lon float64) (WeatherResponse, error) {
 		// Use date as key to group by day
 		dateKey := startTime.Format("2006-01-02")
 
+		// Forecast periods are usually reported in °F
+		if period.TemperatureUnit == "F" {
+			period.Temperature = units.FahrenheitToCelsius(period.Temperature)
+		}
+
 		day, exists := dayMap[dateKey]
 		if !exists {
-			day = struct {
-				date        time.Time
-				minTemp     float64
-				maxTemp     float64
-				description string
-			}{
-				date:        startTime,
-				minTemp:     period.Temperature,
-				maxTemp:     period.Temperature,
-				description: period.ShortForecast,
-			}
-		} else {
-			// For daytime periods, use as max temp
-			if period.IsDaytime && period.Temperature > day.maxTemp {
-				day.maxTemp = period.Temperature
-				day.description = period.ShortForecast
-			}
+			day.date = startTime
+			day.description = period.ShortForecast
+		}
 
-			// For nighttime periods, use as min temp
-			if !period.IsDaytime && period.Temperature < day.minTemp {
-				day.minTemp = period.Temperature
-			}
+		// For daytime periods, use as max temp
+		if period.IsDaytime && (day.maxTemp == nil || period.Temperature > *day.maxTemp) {
+			day.maxTemp = ptr(period.Temperature)
+			day.description = period.ShortForecast
+		}
+
+		// For nighttime periods, use as min temp
+		if !period.IsDaytime && (day.minTemp == nil || period.Temperature < *day.minTemp) {
+			day.minTemp = ptr(period.Temperature)
 		}
 
 		dayMap[dateKey] = day
@@ -458,17 +747,19 @@ func getNWSWeather(lat, lon float64) (WeatherResponse, error) {
 	sort.Strings(days)
 
 	// Add today as the first day
-	today := time.Now().Format("2006-01-02")
+	today := now.Format("2006-01-02")
 	if dayData, ok := dayMap[today]; ok {
 		dailyData := struct {
 			Dt   int64 `json:"dt"`
 			Temp struct {
-				Min float64 `json:"min"`
-				Max float64 `json:"max"`
+				Min *float64 `json:"min"`
+				Max *float64 `json:"max"`
 			} `json:"temp"`
 			Weather []struct {
 				Description string `json:"description"`
 			} `json:"weather"`
+			Rain *float64 `json:"rain"`
+			Snow *float64 `json:"snow"`
 		}{
 			Dt: dayData.date.Unix(),
 			Weather: []struct {
@@ -491,12 +782,14 @@ func getNWSWeather(lat, lon float64) (WeatherResponse, error) {
 		dailyData := struct {
 			Dt   int64 `json:"dt"`
 			Temp struct {
-				Min float64 `json:"min"`
-				Max float64 `json:"max"`
+				Min *float64 `json:"min"`
+				Max *float64 `json:"max"`
 			} `json:"temp"`
 			Weather []struct {
 				Description string `json:"description"`
 			} `json:"weather"`
+			Rain *float64 `json:"rain"`
+			Snow *float64 `json:"snow"`
 		}{
 			Dt: dayData.date.Unix(),
 			Weather: []struct {
@@ -512,22 +805,24 @@ func getNWSWeather(lat, lon float64) (WeatherResponse, error) {
 	return weather, nil
 }
 
-// celsiusToFahrenheit converts temperature from Celsius to Fahrenheit
-func celsiusToFahrenheit(celsius float64) float64 {
-	return celsius*9/5 + 32
-}
-
-func buildForecastText(city, zip string, w WeatherResponse) string {
-	unit := "°F"
-	windUnit := "mph"
-	if false { // Default is imperial, change based on config in real implementation
-		unit = "°C"
-		windUnit = "m/s"
-	}
-	result := fmt.Sprintf("Location: %s (ZIP: %s)\n", city, zip)
-	result += fmt.Sprintf("Now: %.1f%s, feels like %.1f%s, %s\n",
-		w.Current.Temp, unit, w.Current.FeelsLike, unit, w.Current.Weather[0].Description)
-	result += fmt.Sprintf("Humidity: %d%%, Wind: %.1f %s\n", w.Current.Humidity, w.Current.WindSpeed, windUnit)
+func buildForecastText(city, label string, w WeatherResponse, spec units.Spec) string {
+	unit := spec.Temperature.Symbol()
+	windUnit := spec.Wind.Symbol()
+	result := fmt.Sprintf("Location: %s (%s)\n", city, label)
+	humidity := "n/a"
+	if w.Current.Humidity != nil {
+		humidity = fmt.Sprintf("%d%%", *w.Current.Humidity)
+	}
+	condition := "n/a"
+	if len(w.Current.Weather) > 0 {
+		condition = w.Current.Weather[0].Description
+	}
+	result += fmt.Sprintf("Now: %s, feels like %s, %s\n",
+		describeOptional("%.1f", w.Current.Temp, unit), describeOptional("%.1f", w.Current.FeelsLike, unit), condition)
+	result += fmt.Sprintf("Humidity: %s, Wind: %s\n", humidity, describeOptional("%.1f", w.Current.WindSpeed, " "+windUnit))
+	for _, alert := range w.Alerts {
+		result += "Alert: " + describeAlert(alert) + "\n"
+	}
 	result += "7-Day Forecast:\n"
 	days := len(w.Daily)
 	if days > 7 {
@@ -536,22 +831,29 @@ func buildForecastText(city, zip string, w WeatherResponse) string {
 	for i := 1; i < days; i++ {
 		day := w.Daily[i]
 		date := time.Unix(day.Dt, 0).Format("Mon Jan 2")
-		result += fmt.Sprintf("%s: Min %.1f%s, Max %.1f%s, %s\n",
-			date, day.Temp.Min, unit, day.Temp.Max, unit, day.Weather[0].Description)
+		result += fmt.Sprintf("%s: Min %s, Max %s, %s\n",
+			date, describeOptional("%.1f", day.Temp.Min, unit), describeOptional("%.1f", day.Temp.Max, unit), day.Weather[0].Description)
 	}
 	return result
 }
 
-func summarizeForecast(data string) string {
+func summarizeForecast(ctx context.Context, data string) string {
 	openAIKey := os.Getenv("OPENAI_API_KEY")
 	if openAIKey == "" {
 		return "Missing OPENAI_API_KEY environment variable"
 	}
 
-	client := openai.NewClient(openAIKey)
+	if err := validateURL(endpoints.OpenAI); err != nil {
+		return fmt.Sprintf("OpenAI API error: %v", err)
+	}
+
+	clientConfig := openai.DefaultConfig(openAIKey)
+	clientConfig.BaseURL = endpoints.OpenAI
+	clientConfig.HTTPClient = httpClient
+	client := openai.NewClientWithConfig(clientConfig)
 
 	resp, err := client.CreateChatCompletion(
-		context.Background(),
+		ctx,
 		openai.ChatCompletionRequest{
 			Model: openAIModel,
 			Messages: []openai.ChatCompletionMessage{